@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/fasmide/remotemoe/routertwo"
+	"github.com/spf13/cobra"
+)
+
+// exportOnSignal writes a snapshot of router into file, every time remotemoe receives SIGUSR1. The
+// running remotemoe holds the router store, which is why snapshots cannot be taken by another process
+func exportOnSignal(router *routertwo.Router, file string) {
+	if len(exportSignals) == 0 {
+		return
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, exportSignals...)
+
+	for range signals {
+		err := export(router, file)
+		if err != nil {
+			log.Printf("unable to export router: %s", err)
+			continue
+		}
+
+		log.Printf("router exported to %s", file)
+	}
+}
+
+// export writes a snapshot of router into file, file is only replaced once the snapshot is complete
+func export(router *routertwo.Router, file string) error {
+	fd, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return fmt.Errorf("unable to create snapshot: %w", err)
+	}
+
+	err = router.Export(fd)
+	if err != nil {
+		fd.Close()
+		os.Remove(fd.Name())
+
+		return err
+	}
+
+	err = fd.Close()
+	if err != nil {
+		os.Remove(fd.Name())
+		return fmt.Errorf("unable to write snapshot: %w", err)
+	}
+
+	return os.Rename(fd.Name(), file)
+}
+
+// Import returns a *cobra.Command which merges a snapshot into the router
+func Import() *cobra.Command {
+	var from string
+
+	c := &cobra.Command{
+		Use:   "import",
+		Short: "Merge a snapshot into the router",
+		Long: "Merge a snapshot into the router\n\n" +
+			"Stop remotemoe before importing. Hostnames owned by someone else in the router are skipped, as are existing hosts. Snapshots are written by a running remotemoe when it receives SIGUSR1.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			router, err := openRouter()
+			if err != nil {
+				return err
+			}
+			defer router.Close()
+
+			var r io.Reader = cmd.InOrStdin()
+			if from != "-" {
+				fd, err := os.Open(from)
+				if err != nil {
+					return fmt.Errorf("unable to open %s: %w", from, err)
+				}
+				defer fd.Close()
+
+				r = fd
+			}
+
+			imported, skipped, err := router.Import(r)
+			for _, s := range skipped {
+				cmd.PrintErrf("skipped %s\n", s)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			cmd.PrintErrf("%d records imported, %d skipped\n", imported, len(skipped))
+
+			return nil
+		},
+	}
+
+	c.Flags().StringVarP(&from, "input", "i", "-", "file to read the snapshot from, - being stdin")
+
+	return c
+}
+
+// openRouter opens the router configured by REMOTEMOE_ROUTER_STORE
+func openRouter() (*routertwo.Router, error) {
+	db, err := openStore(os.Getenv("REMOTEMOE_ROUTER_STORE"))
+	if err != nil {
+		return nil, err
+	}
+
+	router, err := routertwo.NewRouter(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return router, nil
+}
@@ -0,0 +1,395 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fasmide/remotemoe/routertwo"
+	remotessh "github.com/fasmide/remotemoe/ssh"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/sync/errgroup"
+)
+
+var logger *log.Logger
+
+func init() {
+	logger = log.New(os.Stderr, "[cluster] ", log.Flags())
+}
+
+const (
+	// syncChannel carries changes to the routing table between nodes
+	syncChannel = "remotemoe-sync@remote.moe"
+
+	// dialChannel carries connections to hosts online at the accepting node
+	dialChannel = "remotemoe-dial@remote.moe"
+)
+
+// ErrUnknownNode is returned when dialing nodes that are not connected
+var ErrUnknownNode = errors.New("node is not connected")
+
+// Node connects the router of this node, with the routers of other nodes. Nodes talk ssh with each other,
+// authenticated by a key derived from a secret shared by every node of the cluster
+type Node struct {
+	// Name must be unique in the cluster
+	Name string
+
+	// Router must be set before nodes are served or joined
+	Router *routertwo.Router
+
+	signer ssh.Signer
+
+	linksLock sync.Mutex
+	links     map[string]*link
+}
+
+// New returns a node named name, of the cluster using secret
+func New(name, secret string) (*Node, error) {
+	if name == "" || secret == "" {
+		return nil, fmt.Errorf("nodes must have both a name and a secret")
+	}
+
+	seed := sha256.Sum256([]byte(secret))
+
+	signer, err := ssh.NewSignerFromKey(ed25519.NewKeyFromSeed(seed[:]))
+	if err != nil {
+		return nil, fmt.Errorf("unable to derive cluster key: %w", err)
+	}
+
+	return &Node{Name: name, signer: signer, links: make(map[string]*link)}, nil
+}
+
+// trusted reports whether key is the key of the cluster
+func (n *Node) trusted(key ssh.PublicKey) bool {
+	return bytes.Equal(key.Marshal(), n.signer.PublicKey().Marshal())
+}
+
+// Serve accepts other nodes joining from l
+func (n *Node) Serve(l net.Listener) error {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !n.trusted(key) {
+				return nil, fmt.Errorf("not a key of this cluster")
+			}
+
+			return nil, nil
+		},
+	}
+	config.AddHostKey(n.signer)
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return fmt.Errorf("failed to accept incoming connection: %w", err)
+		}
+
+		go func() {
+			// just like users, other nodes are given 10 seconds to handshake
+			authTimer := time.AfterFunc(10*time.Second, func() {
+				c.Close()
+			})
+
+			conn, chans, reqs, err := ssh.NewServerConn(c, config)
+			if err != nil {
+				logger.Printf("%s: failed to handshake: %s", c.RemoteAddr(), err)
+				return
+			}
+
+			authTimer.Stop()
+
+			n.run(conn, chans, reqs, false)
+		}()
+	}
+}
+
+// Join keeps a connection to the node at addr, reconnecting whenever the connection is lost
+func (n *Node) Join(addr string) {
+	config := n.clientConfig()
+
+	backoff := time.Second
+	for {
+		err := n.join(addr, config)
+		if err != nil {
+			logger.Printf("%s: %s", addr, err)
+		} else {
+			// the connection was fine, until it was lost
+			backoff = time.Second
+		}
+
+		time.Sleep(backoff)
+
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// clientConfig returns the ssh configuration used for joining other nodes
+func (n *Node) clientConfig() *ssh.ClientConfig {
+	return &ssh.ClientConfig{
+		User: n.Name,
+		Auth: []ssh.AuthMethod{ssh.PublicKeys(n.signer)},
+		HostKeyCallback: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			if !n.trusted(key) {
+				return fmt.Errorf("not a key of this cluster")
+			}
+
+			return nil
+		},
+		Timeout: 10 * time.Second,
+	}
+}
+
+func (n *Node) join(addr string, config *ssh.ClientConfig) error {
+	c, err := net.DialTimeout("tcp", addr, config.Timeout)
+	if err != nil {
+		return fmt.Errorf("unable to connect: %w", err)
+	}
+
+	conn, chans, reqs, err := ssh.NewClientConn(c, addr, config)
+	if err != nil {
+		c.Close()
+		return fmt.Errorf("failed to handshake: %w", err)
+	}
+
+	n.run(conn, chans, reqs, true)
+
+	return nil
+}
+
+// run serves conn until it is closed, the joining side opens the sync channel
+func (n *Node) run(conn ssh.Conn, chans <-chan ssh.NewChannel, reqs <-chan *ssh.Request, joined bool) {
+	defer conn.Close()
+
+	go ssh.DiscardRequests(reqs)
+
+	syncs := make(chan ssh.Channel, 1)
+	go func() {
+		for nc := range chans {
+			switch nc.ChannelType() {
+			case syncChannel:
+				channel, requests, err := nc.Accept()
+				if err != nil {
+					logger.Printf("%s: unable to accept sync channel: %s", conn.RemoteAddr(), err)
+					continue
+				}
+
+				go ssh.DiscardRequests(requests)
+
+				select {
+				case syncs <- channel:
+				default:
+					channel.Close()
+				}
+			case dialChannel:
+				go n.acceptDial(nc)
+			default:
+				nc.Reject(ssh.UnknownChannelType, "unknown channel type")
+			}
+		}
+
+		close(syncs)
+	}()
+
+	var channel ssh.Channel
+	if joined {
+		var requests <-chan *ssh.Request
+		var err error
+
+		channel, requests, err = conn.OpenChannel(syncChannel, nil)
+		if err != nil {
+			logger.Printf("%s: unable to open sync channel: %s", conn.RemoteAddr(), err)
+			return
+		}
+
+		go ssh.DiscardRequests(requests)
+	} else {
+		var ok bool
+		channel, ok = <-syncs
+		if !ok {
+			return
+		}
+	}
+
+	l := &link{conn: conn, channel: channel, router: n.Router}
+	err := l.run(n)
+	if err != nil && !errors.Is(err, io.EOF) {
+		logger.Printf("%s: link lost: %s", conn.RemoteAddr(), err)
+	}
+}
+
+// register makes l the link to its peer, replacing any existing link to the same peer
+func (n *Node) register(l *link) {
+	n.linksLock.Lock()
+	existing := n.links[l.peer]
+	n.links[l.peer] = l
+	n.linksLock.Unlock()
+
+	if existing != nil {
+		existing.conn.Close()
+	}
+
+	logger.Printf("%s: linked with %s", l.conn.RemoteAddr(), l.peer)
+}
+
+// unregister removes l, reporting whether it was the link to its peer
+func (n *Node) unregister(l *link) bool {
+	n.linksLock.Lock()
+	defer n.linksLock.Unlock()
+
+	if n.links[l.peer] != l {
+		return false
+	}
+
+	delete(n.links, l.peer)
+
+	return true
+}
+
+// Peers returns the names of the nodes currently connected
+func (n *Node) Peers() []string {
+	n.linksLock.Lock()
+	defer n.linksLock.Unlock()
+
+	peers := make([]string, 0, len(n.links))
+	for peer := range n.links {
+		peers = append(peers, peer)
+	}
+
+	return peers
+}
+
+// broadcast queues m on every link
+func (n *Node) broadcast(m message) {
+	n.linksLock.Lock()
+	defer n.linksLock.Unlock()
+
+	for _, l := range n.links {
+		l.send(m)
+	}
+}
+
+// Put passes a changed record on to every connected node
+func (n *Node) Put(name string, data []byte) {
+	n.broadcast(message{Op: opPut, Name: name, Record: data})
+}
+
+// dialRequest is the extra data of dial channels
+type dialRequest struct {
+	Network string
+	Address string
+
+	// Hostname is the hostname originally dialed
+	Hostname string
+}
+
+// DialContext dials address through node
+func (n *Node) DialContext(ctx context.Context, node, network, address string) (net.Conn, error) {
+	n.linksLock.Lock()
+	l, exists := n.links[node]
+	n.linksLock.Unlock()
+
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownNode, node)
+	}
+
+	remote, err := remotessh.ParseAddr(address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", address, err)
+	}
+
+	type result struct {
+		channel ssh.Channel
+		err     error
+	}
+
+	// opening channels cannot be cancelled, channels opened too late are closed when they arrive
+	done := make(chan result, 1)
+	go func() {
+		channel, requests, err := l.conn.OpenChannel(dialChannel, ssh.Marshal(dialRequest{
+			Network:  network,
+			Address:  address,
+			Hostname: routertwo.Hostname(ctx),
+		}))
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+
+		go ssh.DiscardRequests(requests)
+
+		done <- result{channel: channel}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return nil, fmt.Errorf("unable to dial %s at %s: %w", address, node, r.err)
+		}
+
+		return remotessh.NewChannelConn(r.channel, l.conn.LocalAddr(), remote), nil
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.channel != nil {
+				r.channel.Close()
+			}
+		}()
+
+		return nil, ctx.Err()
+	}
+}
+
+// acceptDial dials the router of this node, on behalf of another node
+func (n *Node) acceptDial(nc ssh.NewChannel) {
+	var req dialRequest
+	err := ssh.Unmarshal(nc.ExtraData(), &req)
+	if err != nil {
+		nc.Reject(ssh.UnknownChannelType, "failed to parse dial request")
+		return
+	}
+
+	ctx := routertwo.FromPeer(context.Background())
+	if req.Hostname != "" {
+		ctx = routertwo.WithHostname(ctx, req.Hostname)
+	}
+
+	conn, err := n.Router.DialContext(ctx, req.Network, req.Address)
+	if err != nil {
+		nc.Reject(ssh.ConnectionFailed, fmt.Sprintf("cannot make connection: %s", err))
+		return
+	}
+
+	channel, requests, err := nc.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	go ssh.DiscardRequests(requests)
+
+	var group errgroup.Group
+
+	group.Go(func() error {
+		_, err := io.Copy(channel, conn)
+		return err
+	})
+
+	group.Go(func() error {
+		_, err := io.Copy(conn, channel)
+		return err
+	})
+
+	group.Wait()
+
+	conn.Close()
+	channel.Close()
+}
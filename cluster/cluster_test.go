@@ -0,0 +1,323 @@
+package cluster
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fasmide/remotemoe/routertwo"
+	"golang.org/x/crypto/ssh"
+)
+
+// echoRoutable echoes everything written to its connections
+type echoRoutable struct {
+	name string
+}
+
+func (e *echoRoutable) FQDN() string {
+	return e.name
+}
+
+func (e *echoRoutable) DialContext(_ context.Context, _, _ string) (net.Conn, error) {
+	c, s := net.Pipe()
+	go func() {
+		io.Copy(s, s)
+		s.Close()
+	}()
+
+	return c, nil
+}
+
+func (e *echoRoutable) Replaced() {}
+
+func newNode(t *testing.T, name string) (*Node, net.Listener) {
+	n, err := New(name, "much secret")
+	if err != nil {
+		t.Fatalf("unable to create node: %s", err)
+	}
+
+	n.Router, err = routertwo.NewRouter(routertwo.NewDirStore(t.TempDir(), ""), routertwo.WithCluster(name, n))
+	if err != nil {
+		t.Fatalf("unable to create new router: %s", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %s", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go n.Serve(l)
+
+	return n, l
+}
+
+// eventually retries fn until it returns true, or fails the test
+func eventually(t *testing.T, what string, fn func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if fn() {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestCluster(t *testing.T) {
+	a, _ := newNode(t, "a")
+	b, bListener := newNode(t, "b")
+
+	// a session is online at a, before the nodes are linked
+	session := &echoRoutable{name: "session.remote.moe"}
+	_, err := a.Router.Online(session)
+	if err != nil {
+		t.Fatalf("unable to set session online: %s", err)
+	}
+
+	err = a.Router.AddName(routertwo.NewName("example.remote.moe", session))
+	if err != nil {
+		t.Fatalf("unable to add name: %s", err)
+	}
+
+	go a.Join(bListener.Addr().String())
+
+	eventually(t, "b to learn about the session", func() bool {
+		host, ok := b.Router.Find("session.remote.moe")
+		return ok && host.(*routertwo.Host).Node == "a"
+	})
+
+	eventually(t, "b to learn about the name", func() bool {
+		_, ok := b.Router.Find("example.remote.moe")
+		return ok
+	})
+
+	// connections to b are forwarded to the session at a
+	c, err := b.Router.DialContext(context.Background(), "tcp", "example.remote.moe:80")
+	if err != nil {
+		t.Fatalf("unable to dial session through b: %s", err)
+	}
+
+	_, err = c.Write([]byte("hello"))
+	if err != nil {
+		t.Fatalf("unable to write: %s", err)
+	}
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(c, buf)
+	if err != nil || string(buf) != "hello" {
+		t.Fatalf("expected echo, got %q: %s", buf, err)
+	}
+
+	c.Close()
+
+	// names added at b, are replicated to a
+	err = b.Router.AddName(routertwo.NewName("other.remote.moe", session))
+	if err != nil {
+		t.Fatalf("unable to add name at b: %s", err)
+	}
+
+	eventually(t, "a to learn about the name added at b", func() bool {
+		_, ok := a.Router.Find("other.remote.moe")
+		return ok
+	})
+
+	err = b.Router.RemoveName("other.remote.moe", session)
+	if err != nil {
+		t.Fatalf("unable to remove name at b: %s", err)
+	}
+
+	eventually(t, "a to forget about the name removed at b", func() bool {
+		_, ok := a.Router.Find("other.remote.moe")
+		return !ok
+	})
+
+	// the session going offline at a, takes it offline at b
+	a.Router.Offline(session)
+
+	eventually(t, "the session to go offline at b", func() bool {
+		host, ok := b.Router.Find("session.remote.moe")
+		return ok && host.(*routertwo.Host).Routable == nil
+	})
+
+	// and when the session comes online at b, a forwards to b
+	_, err = b.Router.Online(session)
+	if err != nil {
+		t.Fatalf("unable to set session online at b: %s", err)
+	}
+
+	eventually(t, "a to learn about the session at b", func() bool {
+		host, ok := a.Router.Find("session.remote.moe")
+		return ok && host.(*routertwo.Host).Node == "b"
+	})
+
+	c, err = a.Router.DialContext(context.Background(), "tcp", "example.remote.moe:80")
+	if err != nil {
+		t.Fatalf("unable to dial session through a: %s", err)
+	}
+
+	c.Close()
+
+	// losing the link takes hosts of b offline at a
+	bListener.Close()
+	b.linksLock.Lock()
+	for _, l := range b.links {
+		l.conn.Close()
+	}
+	b.linksLock.Unlock()
+
+	eventually(t, "the session to go offline at a", func() bool {
+		host, ok := a.Router.Find("session.remote.moe")
+		return ok && host.(*routertwo.Host).Routable == nil
+	})
+}
+
+// closeConn is a ssh.Conn which only knows how to be closed
+type closeConn struct {
+	ssh.Conn
+
+	closed int32
+}
+
+func (c *closeConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+}
+
+func (c *closeConn) Close() error {
+	atomic.AddInt32(&c.closed, 1)
+	return nil
+}
+
+func TestSlowLink(t *testing.T) {
+	conn := &closeConn{}
+	l := &link{peer: "slow", conn: conn, wake: make(chan struct{}, 1)}
+
+	// snapshots does not count towards the limit
+	for i := 0; i < maxOutbox; i++ {
+		l.queue(message{Op: opPut}, true)
+	}
+
+	for i := 0; i < maxOutbox; i++ {
+		l.send(message{Op: opPut})
+	}
+
+	if atomic.LoadInt32(&conn.closed) != 0 {
+		t.Fatalf("link was dropped before the outbox was full")
+	}
+
+	l.send(message{Op: opPut})
+	l.send(message{Op: opPut})
+
+	if atomic.LoadInt32(&conn.closed) != 1 {
+		t.Fatalf("expected link to be dropped once, was closed %d times", conn.closed)
+	}
+
+	if len(l.outbox) != 0 {
+		t.Fatalf("dropped link still holds %d messages", len(l.outbox))
+	}
+}
+
+// drop closes every link of n, and waits for them to be gone
+func drop(t *testing.T, n *Node) {
+	n.linksLock.Lock()
+	for _, l := range n.links {
+		l.conn.Close()
+	}
+	n.linksLock.Unlock()
+
+	eventually(t, "links to be gone", func() bool {
+		return len(n.Peers()) == 0
+	})
+}
+
+// owner returns the owner of the name s at n, if any
+func owner(n *Node, s string) string {
+	rtbl, ok := n.Router.Find(s)
+	if !ok {
+		return ""
+	}
+
+	name, ok := rtbl.(*routertwo.NamedRoute)
+	if !ok {
+		return ""
+	}
+
+	return name.Owner
+}
+
+func TestReconnect(t *testing.T) {
+	a, _ := newNode(t, "a")
+	b, bListener := newNode(t, "b")
+
+	alice := &echoRoutable{name: "alice.remote.moe"}
+	bob := &echoRoutable{name: "bob.remote.moe"}
+	a.Router.Online(alice)
+	b.Router.Online(bob)
+
+	for _, s := range []string{"gone.remote.moe", "kept.remote.moe"} {
+		err := a.Router.AddName(routertwo.NewName(s, alice))
+		if err != nil {
+			t.Fatalf("unable to add name: %s", err)
+		}
+	}
+
+	go a.join(bListener.Addr().String(), a.clientConfig())
+
+	eventually(t, "b to learn about the names", func() bool {
+		return owner(b, "gone.remote.moe") != "" && owner(b, "kept.remote.moe") != ""
+	})
+
+	drop(t, b)
+	drop(t, a)
+
+	// while the nodes are apart, a name is removed at a and the same name is claimed at both nodes
+	err := a.Router.RemoveName("gone.remote.moe", alice)
+	if err != nil {
+		t.Fatalf("unable to remove name: %s", err)
+	}
+
+	err = a.Router.AddName(routertwo.NewName("both.remote.moe", alice))
+	if err != nil {
+		t.Fatalf("unable to add name at a: %s", err)
+	}
+
+	err = b.Router.AddName(routertwo.NewName("both.remote.moe", bob))
+	if err != nil {
+		t.Fatalf("unable to add name at b: %s", err)
+	}
+
+	go a.join(bListener.Addr().String(), a.clientConfig())
+
+	eventually(t, "b to forget about the removed name", func() bool {
+		return owner(b, "gone.remote.moe") == ""
+	})
+
+	eventually(t, "the nodes to agree on the owner of the name claimed at both", func() bool {
+		return owner(a, "both.remote.moe") != "" && owner(a, "both.remote.moe") == owner(b, "both.remote.moe")
+	})
+
+	// the snapshot of b did not bring the removed name back
+	if owner(a, "gone.remote.moe") != "" {
+		t.Fatalf("removed name came back at a")
+	}
+
+	if owner(a, "kept.remote.moe") == "" || owner(b, "kept.remote.moe") == "" {
+		t.Fatalf("expected kept.remote.moe to be kept at both nodes")
+	}
+
+	// names removed after the nodes reconnected, stay removed as well
+	err = b.Router.RemoveName("kept.remote.moe", alice)
+	if err != nil {
+		t.Fatalf("unable to remove name at b: %s", err)
+	}
+
+	eventually(t, "a to forget about the name removed at b", func() bool {
+		return owner(a, "kept.remote.moe") == ""
+	})
+}
@@ -0,0 +1,185 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/fasmide/remotemoe/routertwo"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// opHello is the first message in both directions, naming the node
+	opHello = "hello"
+
+	// opPut replaces a record, if it is a later change than the one known - removed records are put as tombstones
+	opPut = "put"
+)
+
+// maxOutbox is how many changes may be waiting for a node before it is considered too slow, and the link
+// is dropped - the node catches up by reconnecting and receiving a new snapshot
+const maxOutbox = 10000
+
+// message is sent as a line of json on sync channels
+type message struct {
+	Op     string          `json:"op"`
+	Node   string          `json:"node,omitempty"`
+	Name   string          `json:"name,omitempty"`
+	Record json.RawMessage `json:"record,omitempty"`
+}
+
+// link is a connection to another node
+type link struct {
+	peer    string
+	conn    ssh.Conn
+	channel ssh.Channel
+	router  *routertwo.Router
+
+	// messages are queued in the outbox and written by a separate goroutine, so the router is never
+	// held back by a slow node
+	outboxLock sync.Mutex
+	outbox     []message
+	wake       chan struct{}
+	done       chan struct{}
+
+	// snapshot is how many messages of the outbox are part of the snapshot, they are not limited by maxOutbox
+	snapshot int
+	dropped  bool
+}
+
+// send queues m without blocking, nodes falling too far behind are disconnected
+func (l *link) send(m message) {
+	l.queue(m, false)
+}
+
+func (l *link) queue(m message, snapshot bool) {
+	l.outboxLock.Lock()
+	if l.dropped {
+		l.outboxLock.Unlock()
+		return
+	}
+
+	if !snapshot && len(l.outbox)-l.snapshot >= maxOutbox {
+		l.dropped = true
+		l.outbox = nil
+		l.outboxLock.Unlock()
+
+		logger.Printf("%s: %s is too far behind, dropping link", l.conn.RemoteAddr(), l.peer)
+		l.conn.Close()
+
+		return
+	}
+
+	l.outbox = append(l.outbox, m)
+	if snapshot {
+		l.snapshot++
+	}
+	l.outboxLock.Unlock()
+
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// write writes queued messages until the link is done
+func (l *link) write() {
+	enc := json.NewEncoder(l.channel)
+
+	for {
+		select {
+		case <-l.wake:
+		case <-l.done:
+			return
+		}
+
+		l.outboxLock.Lock()
+		queued := l.outbox
+		l.outbox = nil
+		l.snapshot = 0
+		l.outboxLock.Unlock()
+
+		for _, m := range queued {
+			err := enc.Encode(m)
+			if err != nil {
+				logger.Printf("%s: unable to write to %s: %s", l.conn.RemoteAddr(), l.peer, err)
+				l.conn.Close()
+
+				return
+			}
+		}
+	}
+}
+
+// run introduces the nodes to each other, exchanges their routing tables and keeps them in sync
+// until the link is lost
+func (l *link) run(n *Node) error {
+	l.wake = make(chan struct{}, 1)
+	l.done = make(chan struct{})
+	defer close(l.done)
+
+	go l.write()
+
+	l.send(message{Op: opHello, Node: n.Name})
+
+	dec := json.NewDecoder(l.channel)
+
+	var hello message
+	err := dec.Decode(&hello)
+	if err != nil {
+		return fmt.Errorf("unable to read hello: %w", err)
+	}
+
+	if hello.Op != opHello || hello.Node == "" {
+		return fmt.Errorf("expected hello, got %q", hello.Op)
+	}
+
+	if hello.Node == n.Name {
+		return fmt.Errorf("%s is the name of this node", hello.Node)
+	}
+
+	l.peer = hello.Node
+
+	// changes are passed on from now, and since the router is held back while the snapshot is queued,
+	// the other node sees every change in the order it happened
+	n.register(l)
+	defer func() {
+		if n.unregister(l) {
+			l.router.PeerGone(l.peer)
+		}
+	}()
+
+	err = l.router.Snapshot(func(i *routertwo.Intermediate) error {
+		data, err := json.Marshal(i)
+		if err != nil {
+			return err
+		}
+
+		l.queue(message{Op: opPut, Record: data}, true)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to send snapshot: %w", err)
+	}
+
+	for {
+		var m message
+		err = dec.Decode(&m)
+		if err != nil {
+			return err
+		}
+
+		switch m.Op {
+		case opPut:
+			err = l.router.Apply(m.Record)
+		default:
+			err = fmt.Errorf("unknown op %q", m.Op)
+		}
+
+		if err != nil {
+			logger.Printf("%s: unable to apply %s from %s: %s", l.conn.RemoteAddr(), m.Op, l.peer, err)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// exportSignals makes the running remotemoe export its router
+var exportSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,6 @@
+package main
+
+import "os"
+
+// exportSignals is empty on windows, which does not have SIGUSR1
+var exportSignals = []os.Signal{}
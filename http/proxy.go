@@ -23,6 +23,11 @@ type Dialer interface {
 	DialContext(context.Context, string, string) (net.Conn, error)
 }
 
+// PathRouter is implemented by routers which are able to route requests based on their path
+type PathRouter interface {
+	Route(host, path string) (string, bool)
+}
+
 // Initialize sets up this proxy's transport to dial though
 // Router instead of doing classic network dials
 func (h *Proxy) Initialize(router Dialer) {
@@ -50,6 +55,13 @@ func (h *Proxy) Initialize(router Dialer) {
 		localAddr := r.Context().Value(localAddr("localaddr")).(string)
 		_, dstPort, _ := net.SplitHostPort(localAddr)
 
+		// requests matching a path route, are dialed though the key of the route instead
+		if pathRouter, ok := router.(PathRouter); ok {
+			if target, found := pathRouter.Route(host, r.URL.Path); found {
+				host = target
+			}
+		}
+
 		r.URL.Host = fmt.Sprintf("%s:%s", host, dstPort)
 
 		// cant possibly fail right? :)
@@ -1,40 +1,168 @@
 package main
 
 import (
-	"errors"
 	"log"
+	"net"
 	"os"
-	"path"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/fasmide/remotemoe/cluster"
 	"github.com/fasmide/remotemoe/http"
 	"github.com/fasmide/remotemoe/routertwo"
 	"github.com/fasmide/remotemoe/services"
 	"github.com/fasmide/remotemoe/ssh"
+	"github.com/spf13/cobra"
 )
 
 func main() {
-	routerData := "routerdata"
-
-	if os.Getenv("STATE_DIRECTORY") != "" {
-		routerData = path.Join(os.Getenv("STATE_DIRECTORY"), "routerdata")
+	root := &cobra.Command{
+		Use:          "remotemoe",
+		Short:        "remotemoe - ssh plumbing all the things",
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+		Run: func(_ *cobra.Command, _ []string) {
+			serve()
+		},
 	}
 
-	err := os.Mkdir(routerData, 0700)
+	root.CompletionOptions.DisableDefaultCmd = true
+
+	root.AddCommand(Migrate())
+	root.AddCommand(Import())
 
-	// we are not going to be stopping on ErrExists errors
-	if errors.Is(err, os.ErrExist) {
-		err = nil
+	err := root.Execute()
+	if err != nil {
+		os.Exit(1)
 	}
+}
 
+func serve() {
+	db, err := openStore(os.Getenv("REMOTEMOE_ROUTER_STORE"))
 	if err != nil {
-		log.Fatalf("unable to make directory for router data: %s", err)
+		log.Fatalf("unable to open router store: %s", err)
+	}
+
+	// nothing else is writing to the store yet, leftovers from a crash can safely be removed
+	if dir, ok := db.(*routertwo.DirStore); ok {
+		err = dir.Clean()
+		if err != nil {
+			log.Fatalf("unable to clean router store: %s", err)
+		}
+	}
+
+	// no one should be able to take the hostname of remotemoe it self - nor a wildcard on top of it
+	reserved := []string{services.Hostname}
+	if os.Getenv("REMOTEMOE_RESERVED_NAMES") != "" {
+		for _, n := range strings.Split(os.Getenv("REMOTEMOE_RESERVED_NAMES"), ",") {
+			reserved = append(reserved, strings.TrimSpace(n))
+		}
+	}
+
+	var maxNames int
+	if os.Getenv("REMOTEMOE_MAX_NAMES") != "" {
+		maxNames, err = strconv.Atoi(os.Getenv("REMOTEMOE_MAX_NAMES"))
+		if err != nil {
+			log.Fatalf("unable to parse REMOTEMOE_MAX_NAMES: %s", err)
+		}
+	}
+
+	opts := []routertwo.Option{
+		// a single broken record should not keep everyone else from getting online
+		routertwo.WithQuarantine(),
+		routertwo.WithReserved(reserved...),
+		routertwo.WithKeyDomain(services.Hostname),
+		routertwo.WithMaxNames(maxNames),
+	}
+
+	// names outside our own domain can be required to be verified with dns
+	if os.Getenv("REMOTEMOE_VERIFY_NAMES") == "true" {
+		verifier := &routertwo.Verifier{Resolver: net.DefaultResolver, Domain: services.Hostname}
+		if os.Getenv("REMOTEMOE_VERIFY_RESOLVER") != "" {
+			verifier.Resolver = routertwo.NewResolver(os.Getenv("REMOTEMOE_VERIFY_RESOLVER"))
+		}
+
+		opts = append(opts, routertwo.WithVerifier(verifier))
+	}
+
+	// several nodes can share their routing tables, and forward connections to each other
+	var node *cluster.Node
+	if os.Getenv("REMOTEMOE_CLUSTER_SECRET") != "" {
+		name := os.Getenv("REMOTEMOE_CLUSTER_NODE")
+		if name == "" {
+			name, err = os.Hostname()
+			if err != nil {
+				log.Fatalf("unable to figure out name of cluster node: %s", err)
+			}
+		}
+
+		node, err = cluster.New(name, os.Getenv("REMOTEMOE_CLUSTER_SECRET"))
+		if err != nil {
+			log.Fatalf("unable to set up cluster: %s", err)
+		}
+
+		opts = append(opts, routertwo.WithCluster(name, node))
 	}
 
-	router, err := routertwo.NewRouter(routerData)
+	router, err := routertwo.NewRouter(db, opts...)
 	if err != nil {
 		panic(err)
 	}
 
+	if node != nil {
+		node.Router = router
+
+		if os.Getenv("REMOTEMOE_CLUSTER_LISTEN") != "" {
+			l, err := net.Listen("tcp", os.Getenv("REMOTEMOE_CLUSTER_LISTEN"))
+			if err != nil {
+				log.Fatalf("unable to listen for cluster nodes: %s", err)
+			}
+
+			go func() {
+				log.Fatal(node.Serve(l))
+			}()
+		}
+
+		if os.Getenv("REMOTEMOE_CLUSTER_PEERS") != "" {
+			for _, addr := range strings.Split(os.Getenv("REMOTEMOE_CLUSTER_PEERS"), ",") {
+				go node.Join(strings.TrimSpace(addr))
+			}
+		}
+	}
+
+	if os.Getenv("REMOTEMOE_VERIFY_NAMES") == "true" {
+		go router.VerifyEvery(time.Minute)
+	}
+
+	go router.ExpireEvery(time.Minute)
+
+	// the router is exported by the running process, which holds the store
+	exportFile := "routerdata.jsonl"
+	if os.Getenv("REMOTEMOE_EXPORT_FILE") != "" {
+		exportFile = os.Getenv("REMOTEMOE_EXPORT_FILE")
+	}
+
+	go exportOnSignal(router, exportFile)
+
+	events, _ := router.Subscribe()
+	go func() {
+		for e := range events {
+			log.Printf("router: %s", e)
+		}
+	}()
+
+	// hosts that have not been seen within the retention window are removed
+	// from the router, along with all their names
+	if os.Getenv("REMOTEMOE_ROUTER_RETENTION") != "" {
+		retention, err := time.ParseDuration(os.Getenv("REMOTEMOE_ROUTER_RETENTION"))
+		if err != nil {
+			log.Fatalf("unable to parse REMOTEMOE_ROUTER_RETENTION: %s", err)
+		}
+
+		go router.CollectEvery(time.Hour, retention)
+	}
+
 	proxy := &http.Proxy{}
 	proxy.Initialize(router)
 
@@ -53,7 +181,23 @@ func main() {
 		log.Fatalf("cannot get default ssh config: %s", err)
 	}
 
-	sshServer := &ssh.Server{Config: sshConfig, Router: router}
+	sshServer := &ssh.Server{Config: sshConfig, Router: router, DialTimeout: ssh.DefaultDialTimeout}
+
+	// clients are only given so long to accept connections, before they are given up on
+	if os.Getenv("REMOTEMOE_DIAL_TIMEOUT") != "" {
+		sshServer.DialTimeout, err = time.ParseDuration(os.Getenv("REMOTEMOE_DIAL_TIMEOUT"))
+		if err != nil {
+			log.Fatalf("unable to parse REMOTEMOE_DIAL_TIMEOUT: %s", err)
+		}
+	}
+
+	// services that cannot be mux'ed can be given public ports of their own
+	if os.Getenv("REMOTEMOE_TCP_PORTS") != "" {
+		sshServer.Ports, err = ssh.ParsePortRange(os.Getenv("REMOTEMOE_TCP_PORTS"))
+		if err != nil {
+			log.Fatalf("unable to parse REMOTEMOE_TCP_PORTS: %s", err)
+		}
+	}
 
 	services.Serve("ssh", sshServer)
 
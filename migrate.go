@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fasmide/remotemoe/routertwo"
+	"github.com/spf13/cobra"
+)
+
+// Migrate returns a *cobra.Command which copies a routerdata directory into a bolt store
+func Migrate() *cobra.Command {
+	var from, to string
+
+	c := &cobra.Command{
+		Use:   "migrate",
+		Short: "Copy a routerdata directory into a bolt store",
+		Long: "Copy a routerdata directory into a bolt store\n\n" +
+			"Stop remotemoe before migrating, and start it again with REMOTEMOE_ROUTER_STORE=bolt afterwards.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			// a mistyped source would otherwise be created, and migrated as an empty router
+			info, err := os.Stat(from)
+			if err != nil {
+				return fmt.Errorf("unable to migrate from %s: %w", from, err)
+			}
+
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a routerdata directory", from)
+			}
+
+			src, err := openDirStore(from)
+			if err != nil {
+				return err
+			}
+
+			dst, err := routertwo.NewBoltStore(to)
+			if err != nil {
+				return err
+			}
+			defer dst.Close()
+
+			n, err := routertwo.Copy(dst, src)
+			if err != nil {
+				return fmt.Errorf("migration stopped after %d records: %w", n, err)
+			}
+
+			cmd.Printf("%d records copied from %s into %s\n", n, from, to)
+
+			return nil
+		},
+	}
+
+	c.Flags().StringVar(&from, "from", stateFile("routerdata"), "routerdata directory to copy from")
+	c.Flags().StringVar(&to, "to", stateFile("routerdata.db"), "bolt file to copy into")
+
+	return c
+}
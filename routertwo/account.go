@@ -0,0 +1,338 @@
+package routertwo
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"log"
+)
+
+// Account links several keys together, names added by any of the keys are owned by
+// the account and can be managed by every key in it
+type Account struct {
+	ID string `json:"id"`
+
+	// Keys are the FQDNs of the linked keys
+	Keys []string `json:"keys"`
+}
+
+// accountPrefix keeps account ids from ever being valid hostnames
+const accountPrefix = "account_"
+
+func newAccountID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate account id: %w", err)
+	}
+
+	enc := base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+	return accountPrefix + enc.EncodeToString(b), nil
+}
+
+// ownerOf returns the id of the account key belongs to, or key it self if it is not linked
+func (r *Router) ownerOf(key string) string {
+	r.accountsLock.RLock()
+	defer r.accountsLock.RUnlock()
+
+	if a, exists := r.keyAccounts[key]; exists {
+		return a.ID
+	}
+
+	return key
+}
+
+// keysOf returns every key of owner, which is the owner it self if it is not an account
+func (r *Router) keysOf(owner string) []string {
+	r.accountsLock.RLock()
+	defer r.accountsLock.RUnlock()
+
+	a, exists := r.accounts[owner]
+	if !exists {
+		return []string{owner}
+	}
+
+	return append([]string(nil), a.Keys...)
+}
+
+// setAccount adds or replaces the account a
+func (r *Router) setAccount(a *Account) {
+	r.accountsLock.Lock()
+	defer r.accountsLock.Unlock()
+
+	r.accounts[a.ID] = a
+	for _, k := range a.Keys {
+		r.keyAccounts[k] = a
+	}
+}
+
+// Keys returns every key linked with rtbl, including rtbl it self
+func (r *Router) Keys(rtbl Routable) []string {
+	return r.keysOf(r.ownerOf(rtbl.FQDN()))
+}
+
+// Link links the key from, with the key to - to must ask for the same in order for the keys to be
+// linked, Link returns true when that happens and false while waiting for the other side.
+// Once linked, names owned by either key, or their accounts, are moved to a shared account
+func (r *Router) Link(from Routable, to string) (bool, error) {
+	next := r.begin()
+	defer r.finish()
+
+	key := from.FQDN()
+	if key == to {
+		return false, fmt.Errorf("a key cannot be linked with it self")
+	}
+
+	fromOwner, toOwner := r.ownerOf(key), r.ownerOf(to)
+	if fromOwner == toOwner {
+		return true, nil
+	}
+
+	// the other side have not asked for this yet
+	if r.linkRequests[to] != key {
+		r.linkRequests[key] = to
+		return false, nil
+	}
+
+	delete(r.linkRequests, to)
+
+	// the account of from is kept, if any, otherwise the account of to or a brand new one
+	keep := fromOwner
+	if !r.isAccount(keep) {
+		keep = toOwner
+	}
+
+	account := &Account{ID: keep}
+	if !r.isAccount(keep) {
+		id, err := newAccountID()
+		if err != nil {
+			return false, err
+		}
+
+		account.ID = id
+	}
+
+	for _, owner := range []string{fromOwner, toOwner} {
+		account.Keys = append(account.Keys, r.keysOf(owner)...)
+	}
+
+	err := r.store(account.ID, &Intermediate{Account: account})
+	if err != nil {
+		return false, fmt.Errorf("unable to store account: %w", err)
+	}
+
+	// names and paths move into the account
+	for _, owner := range []string{fromOwner, toOwner} {
+		if owner == account.ID {
+			continue
+		}
+
+		err = r.moveNames(next, owner, account.ID)
+		if err == nil {
+			err = r.movePaths(next, owner, account.ID)
+		}
+
+		if err != nil {
+			r.exchange(next)
+			return false, err
+		}
+
+		// a merged account is no longer needed
+		if r.isAccount(owner) {
+			err = r.removeAccount(owner)
+			if err != nil {
+				log.Printf("router: %s", err)
+			}
+		}
+	}
+
+	r.setAccount(account)
+
+	r.exchange(next)
+
+	r.notify(to, fmt.Sprintf("%s is now linked with this key", key))
+
+	return true, nil
+}
+
+// Unlink removes key from the account of from. Names routed to key are routed to from instead, or
+// if from is unlinking it self, to one of the remaining keys
+func (r *Router) Unlink(from Routable, key string) error {
+	next := r.begin()
+	defer r.finish()
+
+	owner := r.ownerOf(from.FQDN())
+	if !r.isAccount(owner) {
+		return fmt.Errorf("there are no keys linked with this key")
+	}
+
+	keys := r.keysOf(owner)
+
+	account := &Account{ID: owner}
+	for _, k := range keys {
+		if k != key {
+			account.Keys = append(account.Keys, k)
+		}
+	}
+
+	if len(account.Keys) == len(keys) {
+		return fmt.Errorf("%s is not linked with this key", key)
+	}
+
+	if len(account.Keys) == 0 {
+		return fmt.Errorf("%s is the last key of its account", key)
+	}
+
+	target := from.FQDN()
+	if target == key {
+		target = account.Keys[0]
+	}
+
+	err := r.store(account.ID, &Intermediate{Account: account})
+	if err != nil {
+		return fmt.Errorf("unable to store account: %w", err)
+	}
+
+	for _, n := range r.nameIndex[owner] {
+		if n.target() != key {
+			continue
+		}
+
+		err = r.replaceName(next, n, func(moved *NamedRoute) {
+			moved.Target = target
+		})
+
+		if err != nil {
+			r.exchange(next)
+			return err
+		}
+	}
+
+	for _, rtbl := range next {
+		p, ok := rtbl.(*PathRoute)
+		if !ok || p.Owner != owner || p.Target != key {
+			continue
+		}
+
+		err = r.replacePath(next, p, func(moved *PathRoute) {
+			moved.Target = target
+		})
+
+		if err != nil {
+			r.exchange(next)
+			return err
+		}
+	}
+
+	r.accountsLock.Lock()
+	delete(r.keyAccounts, key)
+	r.accountsLock.Unlock()
+
+	r.setAccount(account)
+
+	r.exchange(next)
+
+	r.notify(key, fmt.Sprintf("this key was unlinked by %s", from.FQDN()))
+
+	return nil
+}
+
+// removeAccount removes the account id, keys still pointing at it are released from it
+func (r *Router) removeAccount(id string) error {
+	err := r.unlink(id)
+	if err != nil {
+		return fmt.Errorf("unable to remove account %s: %w", id, err)
+	}
+
+	r.forgetAccount(id)
+
+	return nil
+}
+
+func (r *Router) isAccount(owner string) bool {
+	r.accountsLock.RLock()
+	defer r.accountsLock.RUnlock()
+
+	_, exists := r.accounts[owner]
+	return exists
+}
+
+// moveNames moves every name of owner into account, names keep routing to the key they did before
+func (r *Router) moveNames(next map[string]Routable, owner, account string) error {
+	// the index of owner is changed as we go, so we work on a copy
+	names := append([]*NamedRoute(nil), r.nameIndex[owner]...)
+
+	for _, n := range names {
+		target := n.target()
+
+		err := r.replaceName(next, n, func(moved *NamedRoute) {
+			moved.Owner = account
+			moved.Target = target
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// movePaths moves every path of owner into account, paths keep routing to the key they did before
+func (r *Router) movePaths(next map[string]Routable, owner, account string) error {
+	for _, rtbl := range next {
+		p, ok := rtbl.(*PathRoute)
+		if !ok || p.Owner != owner {
+			continue
+		}
+
+		err := r.replacePath(next, p, func(moved *PathRoute) {
+			moved.Owner = account
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// replacePath stores a changed copy of p, and puts it in place of p in next
+func (r *Router) replacePath(next map[string]Routable, p *PathRoute, change func(*PathRoute)) error {
+	// readers may be looking at p, so we change a copy
+	changed := *p
+	change(&changed)
+
+	err := r.store(changed.record(), &Intermediate{PathRoute: &changed})
+	if err != nil {
+		return fmt.Errorf("unable to store %s: %w", changed.FQDN(), err)
+	}
+
+	r.putPath(next, &changed)
+
+	return nil
+}
+
+// replaceName stores a changed copy of n, and puts it in place of n in next and the index
+func (r *Router) replaceName(next map[string]Routable, n *NamedRoute, change func(*NamedRoute)) error {
+	// readers may be looking at n, so we change a copy
+	changed := *n
+	change(&changed)
+
+	err := r.store(changed.Name, &Intermediate{NamedRoute: &changed})
+	if err != nil {
+		return fmt.Errorf("unable to store %s: %w", changed.Name, err)
+	}
+
+	if changed.Owner == n.Owner {
+		r.swapIndex(n, &changed)
+	} else {
+		r.reduceIndex(n.Owner, n)
+		r.index(&changed)
+	}
+
+	next[changed.Name] = &changed
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package routertwo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAccounts(t *testing.T) {
+	d := t.TempDir()
+	r := newTestRouter(t, d)
+
+	laptop := &OtherRoutable{name: "laptop.remote.moe"}
+	desktop := &OtherRoutable{name: "desktop.remote.moe"}
+	r.Online(laptop)
+	r.Online(desktop)
+
+	err := r.AddName(NewName("laptopname.remote.moe", laptop))
+	if err != nil {
+		t.Fatalf("unable to add name: %s", err)
+	}
+
+	p, _ := NewPath("laptoppath.remote.moe/api", laptop)
+	err = r.AddPath(p)
+	if err != nil {
+		t.Fatalf("unable to add path: %s", err)
+	}
+
+	// one side asking is not enough
+	linked, err := r.Link(laptop, desktop.FQDN())
+	if err != nil || linked {
+		t.Fatalf("expected link to be waiting for the other key: %t %s", linked, err)
+	}
+
+	if len(r.Keys(laptop)) != 1 {
+		t.Fatalf("laptop was linked before desktop agreed: %+v", r.Keys(laptop))
+	}
+
+	linked, err = r.Link(desktop, laptop.FQDN())
+	if err != nil || !linked {
+		t.Fatalf("expected keys to be linked: %t %s", linked, err)
+	}
+
+	if len(r.Keys(laptop)) != 2 || len(r.Keys(desktop)) != 2 {
+		t.Fatalf("expected two linked keys: %+v", r.Keys(laptop))
+	}
+
+	// names added before linking moves into the account, and keeps their target
+	names, _ := r.Names(desktop)
+	if len(names) != 1 || names[0].Target != laptop.FQDN() {
+		t.Fatalf("expected desktop to see laptops name: %+v", names)
+	}
+
+	paths := r.Paths(desktop)
+	if len(paths) != 1 || paths[0].Target != laptop.FQDN() {
+		t.Fatalf("expected desktop to see laptops path: %+v", paths)
+	}
+
+	err = r.AddName(NewName("desktopname.remote.moe", desktop))
+	if err != nil {
+		t.Fatalf("unable to add name: %s", err)
+	}
+
+	// any key may manage names of the account
+	err = r.RemoveName("desktopname.remote.moe", laptop)
+	if err != nil {
+		t.Fatalf("laptop was unable to remove desktops name: %s", err)
+	}
+
+	// other keys may not
+	other := &OtherRoutable{name: "other.remote.moe"}
+	err = r.RemoveName("laptopname.remote.moe", other)
+	if err == nil {
+		t.Fatalf("other was able to remove the accounts name")
+	}
+
+	// accounts survive restarts
+	r = newTestRouter(t, d)
+
+	r.Online(laptop)
+	r.Online(desktop)
+
+	if len(r.Keys(desktop)) != 2 {
+		t.Fatalf("expected linked keys after restart: %+v", r.Keys(desktop))
+	}
+
+	names, _ = r.Names(desktop)
+	if len(names) != 1 {
+		t.Fatalf("expected accounts name after restart: %+v", names)
+	}
+
+	// unlinking moves names routed to the unlinked key, to the key unlinking it
+	err = r.Unlink(desktop, laptop.FQDN())
+	if err != nil {
+		t.Fatalf("unable to unlink: %s", err)
+	}
+
+	if len(r.Keys(laptop)) != 1 {
+		t.Fatalf("laptop is still linked: %+v", r.Keys(laptop))
+	}
+
+	names, _ = r.Names(desktop)
+	if len(names) != 1 || names[0].Target != desktop.FQDN() {
+		t.Fatalf("expected laptopname to be routed to desktop: %+v", names)
+	}
+
+	paths = r.Paths(desktop)
+	if len(paths) != 1 || paths[0].Target != desktop.FQDN() {
+		t.Fatalf("expected laptoppath to be routed to desktop: %+v", paths)
+	}
+
+	names, _ = r.Names(laptop)
+	if len(names) != 0 {
+		t.Fatalf("laptop still has names: %+v", names)
+	}
+
+	err = r.Unlink(desktop, desktop.FQDN())
+	if err == nil {
+		t.Fatalf("desktop was able to unlink the last key of its account")
+	}
+}
+
+func TestCollectAccounts(t *testing.T) {
+	r := newTestRouter(t, t.TempDir())
+
+	stale := &OtherRoutable{name: "stale.remote.moe"}
+	online := &OtherRoutable{name: "online.remote.moe"}
+	r.Online(stale)
+	r.Online(online)
+
+	// paths added before linking, are collected with the account
+	p, _ := NewPath("stalepath.remote.moe/", stale)
+	err := r.AddPath(p)
+	if err != nil {
+		t.Fatalf("unable to add path: %s", err)
+	}
+
+	r.Link(stale, online.FQDN())
+	r.Link(online, stale.FQDN())
+
+	err = r.AddName(NewName("stalename.remote.moe", stale))
+	if err != nil {
+		t.Fatalf("unable to add name: %s", err)
+	}
+
+	r.Offline(stale)
+
+	// one key of the account is still online
+	reaped, err := r.Collect(0)
+	if err != nil || len(reaped) != 0 {
+		t.Fatalf("expected nothing to be collected: %d %s", len(reaped), err)
+	}
+
+	r.Offline(online)
+
+	reaped, err = r.Collect(-time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected collect error: %s", err)
+	}
+
+	if len(reaped) != 4 {
+		t.Fatalf("expected both keys, their name and path to be collected, got %d routes", len(reaped))
+	}
+
+	if r.ownerOf(stale.FQDN()) != stale.FQDN() {
+		t.Fatalf("account was not removed")
+	}
+}
@@ -0,0 +1,110 @@
+package routertwo
+
+import (
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltRoutes     = []byte("routes")
+	boltQuarantine = []byte("quarantine")
+)
+
+// BoltStore stores records in a single bbolt key/value file
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens, or creates, the bbolt database at p
+func NewBoltStore(p string) (*BoltStore, error) {
+	db, err := bolt.Open(p, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s: %w", p, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltRoutes)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucketIfNotExists(boltQuarantine)
+		return err
+	})
+
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to create buckets in %s: %w", p, err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+// Walk calls fn with every record - records are read up front such that fn
+// is free to modify the store
+func (b *BoltStore) Walk(fn func(name string, data []byte) error) error {
+	names := make([]string, 0)
+	records := make([][]byte, 0)
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltRoutes).ForEach(func(k, v []byte) error {
+			// bolt owns k and v, only for the duration of the transaction
+			names = append(names, string(k))
+			records = append(records, append([]byte(nil), v...))
+			return nil
+		})
+	})
+
+	if err != nil {
+		return fmt.Errorf("unable to read records: %w", err)
+	}
+
+	for i, name := range names {
+		err = fn(name, records[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Put creates or replaces a record
+func (b *BoltStore) Put(name string, data []byte) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltRoutes).Put([]byte(name), data)
+	})
+}
+
+// Delete removes a record
+func (b *BoltStore) Delete(name string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltRoutes).Delete([]byte(name))
+	})
+}
+
+// Quarantine moves a record into the quarantine bucket
+func (b *BoltStore) Quarantine(name string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		routes := tx.Bucket(boltRoutes)
+
+		data := routes.Get([]byte(name))
+		if data == nil {
+			return fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+
+		err := tx.Bucket(boltQuarantine).Put([]byte(name), data)
+		if err != nil {
+			return err
+		}
+
+		return routes.Delete([]byte(name))
+	})
+}
+
+// Close closes the underlying database file
+func (b *BoltStore) Close() error {
+	return b.db.Close()
+}
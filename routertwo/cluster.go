@@ -0,0 +1,331 @@
+package routertwo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Cluster is implemented by whatever connects routers of several nodes. The router passes every change
+// it stores on to the cluster, and dials hosts online at other nodes through it
+type Cluster interface {
+	// Put passes changes to records on to the other nodes, removed records are passed on as tombstones.
+	// Put is called while the router is being edited and must not block
+	Put(name string, data []byte)
+
+	// DialContext dials address at node
+	DialContext(ctx context.Context, node, network, address string) (net.Conn, error)
+}
+
+// ErrLoop is returned when dialing hosts of other nodes, on behalf of yet another node
+var ErrLoop = errors.New("host is not online at this node")
+
+// WithCluster makes the router a node of c, named node - node names must be unique in the cluster
+func WithCluster(node string, c Cluster) Option {
+	return func(r *Router) {
+		r.node = node
+		r.cluster = c
+	}
+}
+
+type peerKey struct{}
+
+// FromPeer marks ctx as dialing on behalf of another node. Such dials only reach hosts online at this node,
+// as other nodes are expected to dial hosts online elsewhere them selves
+func FromPeer(ctx context.Context) context.Context {
+	return context.WithValue(ctx, peerKey{}, true)
+}
+
+// remote is a host online at another node
+type remote struct {
+	node    string
+	name    string
+	cluster Cluster
+}
+
+func (r *remote) FQDN() string {
+	return r.name
+}
+
+func (r *remote) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if ctx.Value(peerKey{}) != nil {
+		return nil, fmt.Errorf("%w: %s is online at %s", ErrLoop, r.name, r.node)
+	}
+
+	return r.cluster.DialContext(ctx, r.node, network, address)
+}
+
+// Replaced does nothing for remote hosts, the node of the host replaces its session once
+// it learns about the new session
+func (r *remote) Replaced() {}
+
+// Node returns the name of the router in its cluster, if any
+func (r *Router) Node() string {
+	return r.node
+}
+
+// put stores a record received from another node, without passing it on again
+func (r *Router) put(n string, i *Intermediate) error {
+	data, err := json.Marshal(i)
+	if err != nil {
+		return fmt.Errorf("unable to encode data: %w", err)
+	}
+
+	err = r.db.Put(n, data)
+	if err != nil {
+		return err
+	}
+
+	r.remember(n, i)
+
+	return nil
+}
+
+// Apply applies a record received from another node, if it is a later change than the one this node have.
+// Hosts are applied again at the same version, as nodes forget where hosts are online when nodes are gone
+func (r *Router) Apply(data []byte) error {
+	var i Intermediate
+	err := json.Unmarshal(data, &i)
+	if err != nil {
+		return fmt.Errorf("unable to decode json: %w", err)
+	}
+
+	err = i.validate()
+	if err != nil {
+		return err
+	}
+
+	next := r.begin()
+	defer r.finish()
+
+	known, exists := r.versions[i.name()]
+	if exists && (known.newer(i.version()) || (i.Host == nil && !i.version().newer(known))) {
+		return nil
+	}
+
+	// changes made here from now on, are later than the one received
+	r.observe(i.version())
+
+	// sessions online here, stay online here - and the other nodes are told again
+	if host := r.localHost(next[i.name()]); host != nil && i.Host == nil {
+		return r.store(host.Name, &Intermediate{Host: host})
+	}
+
+	switch {
+	case i.Host != nil:
+		return r.applyHost(next, &i)
+
+	case i.Tombstone != nil:
+		return r.applyTombstone(next, &i)
+
+	case i.Account != nil:
+		err = r.put(i.Account.ID, &i)
+		if err != nil {
+			return err
+		}
+
+		r.forgetAccount(i.Account.ID)
+		r.setAccount(i.Account)
+
+	case i.NamedRoute != nil:
+		n := i.NamedRoute
+
+		err = r.put(n.Name, &i)
+		if err != nil {
+			return err
+		}
+
+		existing, _ := next[n.Name].(*NamedRoute)
+		if existing != nil {
+			r.reduceIndex(existing.Owner, existing)
+		}
+
+		n.router = r
+		r.index(n)
+		next[n.Name] = n
+
+		r.exchange(next)
+
+		// the name was claimed at another node at the same time, and the other claim won
+		if existing != nil && existing.Owner != n.Owner {
+			r.notify(existing.Owner, fmt.Sprintf("%s was claimed by someone else at the same time", n.Name))
+		}
+
+		return nil
+
+	case i.PathRoute != nil:
+		err = r.put(i.PathRoute.record(), &i)
+		if err != nil {
+			return err
+		}
+
+		i.PathRoute.router = r
+		r.putPath(next, i.PathRoute)
+	}
+
+	r.exchange(next)
+
+	return nil
+}
+
+// localHost returns rtbl if it is a host online at this node
+func (r *Router) localHost(rtbl Routable) *Host {
+	host, ok := rtbl.(*Host)
+	if !ok || host.Routable == nil {
+		return nil
+	}
+
+	if _, isRemote := host.Routable.(*remote); isRemote {
+		return nil
+	}
+
+	return host
+}
+
+// applyHost updates a host online at another node, or offline
+func (r *Router) applyHost(next map[string]Routable, i *Intermediate) error {
+	h := i.Host
+
+	// this node knows better about its own sessions
+	if h.Node == r.node {
+		return nil
+	}
+
+	existing := next[h.Name]
+	local := r.localHost(existing)
+
+	// a host going offline elsewhere, does not take our session offline - the other nodes are told again
+	if local != nil && h.Node == "" {
+		return r.store(local.Name, &Intermediate{Host: local})
+	}
+
+	err := r.put(h.Name, i)
+	if err != nil {
+		return err
+	}
+
+	// a squatting name is removed, just like when the host comes online locally
+	if n, ok := existing.(*NamedRoute); ok {
+		r.reduceIndex(n.Owner, n)
+	}
+
+	// the node where the host came online removes squatting paths for everyone, this node only forgets them
+	var evicted []*PathRoute
+	if h.Node != "" {
+		evicted, err = r.evictPaths(next, h.Name, r.db.Delete)
+		if err != nil {
+			return err
+		}
+	}
+
+	host := &Host{Name: h.Name, Node: h.Node, LastSeen: h.LastSeen, Created: h.Created}
+	if h.Node != "" {
+		host.Routable = &remote{node: h.Node, name: h.Name, cluster: r.cluster}
+	}
+
+	next[h.Name] = host
+
+	r.exchange(next)
+
+	// the session moved to another node, our session must go
+	if local != nil {
+		go local.Replaced()
+		r.emit(HostReplaced, host)
+	}
+
+	for _, p := range evicted {
+		r.emit(NameRemoved, p)
+	}
+
+	if h.Node != "" {
+		r.emit(HostOnline, host)
+	}
+
+	return nil
+}
+
+// applyTombstone removes the record of a tombstone received from another node, and keeps the tombstone
+func (r *Router) applyTombstone(next map[string]Routable, i *Intermediate) error {
+	n := i.Tombstone.Name
+
+	err := r.put(n, i)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(n, accountPrefix) {
+		r.forgetAccount(n)
+		return nil
+	}
+
+	// path routes are stored with their slashes escaped
+	key := n
+	if unescaped, err := url.PathUnescape(n); err == nil {
+		key = unescaped
+	}
+
+	rtbl, exists := next[key]
+	if !exists {
+		return nil
+	}
+
+	switch route := rtbl.(type) {
+	case *NamedRoute:
+		r.reduceIndex(route.Owner, route)
+	case *PathRoute:
+		r.reducePathIndex(route)
+	}
+
+	delete(next, key)
+
+	r.exchange(next)
+
+	return nil
+}
+
+// PeerGone takes every host online at node offline, as node can no longer be reached
+func (r *Router) PeerGone(node string) {
+	next := r.begin()
+	defer r.finish()
+
+	gone := make([]*Host, 0)
+	for name, rtbl := range next {
+		host, ok := rtbl.(*Host)
+		if !ok || host.Node != node {
+			continue
+		}
+
+		if _, isRemote := host.Routable.(*remote); !isRemote {
+			continue
+		}
+
+		host = &Host{Name: host.Name, LastSeen: host.LastSeen, Created: host.Created}
+		next[name] = host
+
+		gone = append(gone, host)
+	}
+
+	r.exchange(next)
+
+	for _, host := range gone {
+		r.emit(HostOffline, host)
+	}
+}
+
+// forgetAccount removes the account id from memory
+func (r *Router) forgetAccount(id string) {
+	r.accountsLock.Lock()
+	defer r.accountsLock.Unlock()
+
+	for key, a := range r.keyAccounts {
+		if a.ID == id {
+			delete(r.keyAccounts, key)
+		}
+	}
+
+	delete(r.accounts, id)
+}
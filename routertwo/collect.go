@@ -0,0 +1,138 @@
+package routertwo
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Collect removes hosts which have been offline for longer than retention, together with
+// every NamedRoute and PathRoute they own. The removed routes are returned, hosts after their names.
+//
+// Linked keys are only removed once every key of their account is stale, together with the account.
+//
+// Names whose owner have never been online, does not have a LastSeen to judge them by
+// and will not be collected.
+func (r *Router) Collect(retention time.Duration) ([]Routable, error) {
+	next := r.begin()
+	defer r.finish()
+
+	deadline := time.Now().Add(-retention)
+	reaped := make([]Routable, 0)
+
+	stale := func(key string) bool {
+		host, ok := next[key].(*Host)
+		if !ok {
+			return true
+		}
+
+		// online hosts, and hosts seen recently are left alone
+		return host.Routable == nil && !host.LastSeen.After(deadline)
+	}
+
+	var err error
+	for fqdn, rtbl := range next {
+		if _, ok := rtbl.(*Host); !ok || !stale(fqdn) {
+			continue
+		}
+
+		owner := r.ownerOf(fqdn)
+		keys := r.keysOf(owner)
+
+		allStale := true
+		for _, key := range keys {
+			allStale = allStale && stale(key)
+		}
+
+		if !allStale {
+			continue
+		}
+
+		// names have to go before their owner, otherwise we could
+		// end up with names pointing at nothing if the host fails to unlink
+		for _, n := range r.nameIndex[owner] {
+			err = r.unlink(n.FQDN())
+			if err != nil {
+				break
+			}
+
+			r.reduceIndex(owner, n)
+			delete(next, n.FQDN())
+
+			reaped = append(reaped, n)
+		}
+
+		if err != nil {
+			break
+		}
+
+		var paths []Routable
+		paths, err = r.removePaths(next, owner)
+		reaped = append(reaped, paths...)
+
+		if err != nil {
+			break
+		}
+
+		for _, key := range keys {
+			host, exists := next[key]
+			if !exists {
+				continue
+			}
+
+			err = r.unlink(key)
+			if err != nil {
+				break
+			}
+
+			delete(next, key)
+
+			reaped = append(reaped, host)
+		}
+
+		if err != nil {
+			break
+		}
+
+		if r.isAccount(owner) {
+			err = r.removeAccount(owner)
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	r.exchange(next)
+
+	for _, rtbl := range reaped {
+		if _, ok := rtbl.(*Host); ok {
+			r.emit(HostRemoved, rtbl)
+			continue
+		}
+
+		r.emit(NameRemoved, rtbl)
+	}
+
+	if err != nil {
+		return reaped, fmt.Errorf("unable to collect: %w", err)
+	}
+
+	return reaped, nil
+}
+
+// CollectEvery runs Collect every interval and logs what was removed - it never returns
+func (r *Router) CollectEvery(interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		reaped, err := r.Collect(retention)
+		for _, rtbl := range reaped {
+			log.Printf("router: collected %s", rtbl.FQDN())
+		}
+
+		if err != nil {
+			log.Printf("router: %s", err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package routertwo
+
+import (
+	"fmt"
+	"time"
+)
+
+// EventType describes what happened in the router
+type EventType int
+
+const (
+	// HostOnline is emitted when a host comes online
+	HostOnline EventType = iota
+
+	// HostOffline is emitted when a host goes offline
+	HostOffline
+
+	// HostReplaced is emitted when an online host is replaced by a new session with the same key
+	HostReplaced
+
+	// HostRemoved is emitted when a host is removed from the router altogether
+	HostRemoved
+
+	// NameAdded is emitted when a NamedRoute is added
+	NameAdded
+
+	// NameRemoved is emitted when a NamedRoute is removed
+	NameRemoved
+
+	// NameVerified is emitted when a pending NamedRoute is verified
+	NameVerified
+
+	// NameTransferred is emitted when a NamedRoute is handed over to another owner
+	NameTransferred
+)
+
+func (t EventType) String() string {
+	switch t {
+	case HostOnline:
+		return "online"
+	case HostOffline:
+		return "offline"
+	case HostReplaced:
+		return "replaced"
+	case HostRemoved:
+		return "removed"
+	case NameAdded:
+		return "name added"
+	case NameRemoved:
+		return "name removed"
+	case NameVerified:
+		return "name verified"
+	case NameTransferred:
+		return "name transferred"
+	}
+
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event describes a change to the routing table
+type Event struct {
+	Type EventType
+
+	// FQDN of the host or name in question
+	FQDN string
+
+	// Owner is the owner of a NamedRoute, and empty for hosts
+	Owner string
+
+	Time time.Time
+}
+
+func (e Event) String() string {
+	if e.Owner != "" {
+		return fmt.Sprintf("%s %s (%s)", e.Type, e.FQDN, e.Owner)
+	}
+
+	return fmt.Sprintf("%s %s", e.Type, e.FQDN)
+}
+
+// subscriptionBuffer is how many events a subscriber can fall behind before events are dropped
+const subscriptionBuffer = 128
+
+// Subscribe returns a channel of router events and a func which ends the subscription.
+// The router never waits for subscribers - events are dropped for subscribers that do not keep up
+func (r *Router) Subscribe() (<-chan Event, func()) {
+	c := make(chan Event, subscriptionBuffer)
+
+	r.subscribersLock.Lock()
+	r.subscribers[c] = struct{}{}
+	r.subscribersLock.Unlock()
+
+	return c, func() {
+		r.subscribersLock.Lock()
+		defer r.subscribersLock.Unlock()
+
+		// calling this more then once should not close c twice
+		if _, exists := r.subscribers[c]; !exists {
+			return
+		}
+
+		delete(r.subscribers, c)
+		close(c)
+	}
+}
+
+func (r *Router) emit(t EventType, rtbl Routable) {
+	e := Event{Type: t, FQDN: rtbl.FQDN(), Time: time.Now()}
+	if n, ok := rtbl.(*NamedRoute); ok {
+		e.Owner = n.Owner
+	}
+
+	r.subscribersLock.Lock()
+	defer r.subscribersLock.Unlock()
+
+	for c := range r.subscribers {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package routertwo
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Expire removes every NamedRoute which have expired by now, the removed names are returned. Tombstones
+// older than tombstoneRetention are forgotten as well
+func (r *Router) Expire(now time.Time) ([]*NamedRoute, error) {
+	next := r.begin()
+	defer r.finish()
+
+	expired := make([]*NamedRoute, 0)
+
+	var err error
+	for _, rtbl := range next {
+		n, ok := rtbl.(*NamedRoute)
+		if !ok || !n.expired(now) {
+			continue
+		}
+
+		err = r.unlink(n.FQDN())
+		if err != nil {
+			break
+		}
+
+		r.reduceIndex(n.Owner, n)
+		delete(next, n.FQDN())
+
+		expired = append(expired, n)
+	}
+
+	r.exchange(next)
+
+	// tombstones are only kept for so long, they are forgotten along with the expired names
+	if err == nil {
+		err = r.prune(now)
+	}
+
+	for _, n := range expired {
+		r.emit(NameRemoved, n)
+		r.notify(n.Owner, fmt.Sprintf("%s expired and was removed", n.Name))
+	}
+
+	if err != nil {
+		return expired, fmt.Errorf("unable to expire: %w", err)
+	}
+
+	return expired, nil
+}
+
+// ExpireEvery runs Expire every interval and logs what was removed - it never returns
+func (r *Router) ExpireEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		expired, err := r.Expire(now)
+		for _, n := range expired {
+			log.Printf("router: %s expired", n.FQDN())
+		}
+
+		if err != nil {
+			log.Printf("router: %s", err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package routertwo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestExpire(t *testing.T) {
+	d := t.TempDir()
+	r := newTestRouter(t, d)
+
+	owner := &OtherRoutable{name: "owner.remote.moe"}
+	r.Online(owner)
+
+	now := time.Now()
+
+	review := NewName("review.remote.moe", owner)
+	review.Expires = now.Add(time.Hour)
+
+	err := r.AddName(review)
+	if err != nil {
+		t.Fatalf("unable to add name: %s", err)
+	}
+
+	err = r.AddName(NewName("forever.remote.moe", owner))
+	if err != nil {
+		t.Fatalf("unable to add name: %s", err)
+	}
+
+	expired, err := r.Expire(now)
+	if err != nil || len(expired) != 0 {
+		t.Fatalf("expected nothing to expire yet: %d %s", len(expired), err)
+	}
+
+	// expiry is stored with the name
+	r = newTestRouter(t, d)
+
+	r.Online(owner)
+
+	restored, _ := r.Find("review.remote.moe")
+	if !restored.(*NamedRoute).Expires.Equal(review.Expires) {
+		t.Fatalf("expiry was not restored: %+v", restored)
+	}
+
+	// expired names does not route, even before they are removed
+	_, err = r.DialContext(context.TODO(), "tcp", "review.remote.moe:80")
+	if !errors.Is(err, errDummy) {
+		t.Fatalf("expected review.remote.moe to route, got: %s", err)
+	}
+
+	expired, err = r.Expire(now.Add(2 * time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected expire error: %s", err)
+	}
+
+	if len(expired) != 1 || expired[0].FQDN() != "review.remote.moe" {
+		t.Fatalf("expected review.remote.moe to expire, got: %+v", expired)
+	}
+
+	_, exists := r.Find("review.remote.moe")
+	if exists {
+		t.Fatalf("review.remote.moe is still routed")
+	}
+
+	_, err = os.Stat(path.Join(d, "review.remote.moe.json"))
+	if err == nil {
+		t.Fatalf("review.remote.moe was not removed from fs")
+	}
+
+	names, _ := r.Names(owner)
+	if len(names) != 1 || names[0].FQDN() != "forever.remote.moe" {
+		t.Fatalf("unexpected names left: %+v", names)
+	}
+
+	// adding a name again without an expiry, makes it permanent
+	temporary := NewName("temporary.remote.moe", owner)
+	temporary.Expires = now.Add(-time.Minute)
+
+	err = r.AddName(temporary)
+	if err != nil {
+		t.Fatalf("unable to add name: %s", err)
+	}
+
+	_, err = r.DialContext(context.TODO(), "tcp", "temporary.remote.moe:80")
+	if err == nil || errors.Is(err, errDummy) {
+		t.Fatalf("expected expired name to not route, got: %s", err)
+	}
+
+	err = r.AddName(NewName("temporary.remote.moe", owner))
+	if err != nil {
+		t.Fatalf("unable to add name: %s", err)
+	}
+
+	expired, _ = r.Expire(now.Add(2 * time.Hour))
+	if len(expired) != 0 {
+		t.Fatalf("renewed name expired: %+v", expired)
+	}
+}
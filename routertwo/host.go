@@ -15,6 +15,12 @@ type Host struct {
 	Routable `json:"-"`
 	Name     string `json:"name"`
 
+	// Standby holds sessions waiting to take over, should the current one go offline
+	Standby []Routable `json:"-"`
+
+	// Node is the cluster node the host is online at, if clustering
+	Node string `json:"node,omitempty"`
+
 	// LastSeen is used when garbage collecting
 	LastSeen time.Time `json:"lastseen"`
 	Created  time.Time `json:"created"`
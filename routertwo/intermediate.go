@@ -2,22 +2,34 @@ package routertwo
 
 import "fmt"
 
-// Intermediate is able to json parse either Hosts or NamedRoutes from json files
+// Intermediate is able to json parse either Hosts, NamedRoutes, PathRoutes, Accounts or Tombstones from json files
 type Intermediate struct {
 	Host       *Host       `json:"host,omitempty"`
 	NamedRoute *NamedRoute `json:"namedroute,omitempty"`
+	PathRoute  *PathRoute  `json:"pathroute,omitempty"`
+	Account    *Account    `json:"account,omitempty"`
+	Tombstone  *Tombstone  `json:"tombstone,omitempty"`
+
+	// Version orders changes to the record within a cluster
+	Version *Version `json:"version,omitempty"`
 }
 
-// Wake wakes up a newly parsed Host or NamedRoute
-// Named routes needs to know the current router
+// Wake wakes up a newly parsed Host, NamedRoute or PathRoute
+// Named and path routes needs to know the current router
 func (i *Intermediate) Wake(r *Router) (Routable, error) {
 	if i.Host != nil {
+		// hosts are never online, until they come online again
+		i.Host.Node = ""
 		return i.Host, nil
 	}
 	if i.NamedRoute != nil {
 		i.NamedRoute.router = r
 		return i.NamedRoute, nil
 	}
+	if i.PathRoute != nil {
+		i.PathRoute.router = r
+		return i.PathRoute, nil
+	}
 
 	return nil, fmt.Errorf("invalid json parsed")
 }
@@ -0,0 +1,221 @@
+package routertwo
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"time"
+)
+
+// Kind is the kind of a routing table entry
+type Kind int
+
+const (
+	// AnyKind matches every kind of entry in filters
+	AnyKind Kind = iota
+
+	// HostKind entries are keys
+	HostKind
+
+	// NameKind entries are NamedRoutes
+	NameKind
+
+	// PathKind entries are PathRoutes
+	PathKind
+)
+
+func (k Kind) String() string {
+	switch k {
+	case AnyKind:
+		return "any"
+	case HostKind:
+		return "host"
+	case NameKind:
+		return "name"
+	case PathKind:
+		return "path"
+	}
+
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Entry describes an entry of the routing table
+type Entry struct {
+	Kind Kind
+	FQDN string
+
+	// Owner is the key or account owning the entry, hosts are owned by them selves or their account
+	Owner string
+
+	// Target is the key names and paths are routed to, and empty for hosts
+	Target string
+
+	// Online reports whether the host, or the target of names and paths, is online
+	Online bool
+
+	// Sessions is the number of sessions serving the host, pools and sessions on standby included
+	Sessions int
+
+	Pending bool
+	Expires time.Time
+
+	// LastSeen and Created are those of the host, or the target of names and paths
+	LastSeen time.Time
+	Created  time.Time
+}
+
+// Filter selects entries of the routing table, the zero Filter selects everything
+type Filter struct {
+	Kind Kind
+
+	// Online and Offline only selects entries which are online or offline
+	Online  bool
+	Offline bool
+
+	// Owner only selects entries owned by the key or account, keys in accounts selects those of the account
+	Owner string
+
+	// Name only selects entries with an FQDN matching the pattern, using path.Match syntax -
+	// *.example.com matches both the wildcard name it self, and names covered by it
+	Name string
+}
+
+func (f Filter) match(r *Router, e Entry) bool {
+	if f.Kind != AnyKind && f.Kind != e.Kind {
+		return false
+	}
+
+	if (f.Online && !e.Online) || (f.Offline && e.Online) {
+		return false
+	}
+
+	if f.Owner != "" && r.ownerOf(f.Owner) != e.Owner {
+		return false
+	}
+
+	if f.Name != "" {
+		matched, _ := path.Match(f.Name, e.FQDN)
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// List returns the entries of the routing table selected by filter, sorted by FQDN
+func (r *Router) List(filter Filter) []Entry {
+	table := r.table()
+
+	entries := make([]Entry, 0)
+	for _, rtbl := range table {
+		e := r.entry(table, rtbl)
+		if filter.match(r, e) {
+			entries = append(entries, e)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].FQDN < entries[j].FQDN
+	})
+
+	return entries
+}
+
+func (r *Router) entry(table map[string]Routable, rtbl Routable) Entry {
+	e := Entry{FQDN: rtbl.FQDN(), Owner: r.owner(rtbl)}
+
+	switch route := rtbl.(type) {
+	case *Host:
+		e.Kind = HostKind
+	case *NamedRoute:
+		e.Kind = NameKind
+		e.Target = route.target()
+		e.Pending = route.Pending
+		e.Expires = route.Expires
+	case *PathRoute:
+		e.Kind = PathKind
+		e.Target = route.Target
+		e.Pending = route.Pending
+	}
+
+	key := e.FQDN
+	if e.Target != "" {
+		key = e.Target
+	}
+
+	host, ok := table[key].(*Host)
+	if !ok {
+		return e
+	}
+
+	e.LastSeen = host.LastSeen
+	e.Created = host.Created
+	e.Online = host.Routable != nil
+
+	// other kinds of entries reports the sessions of their target, but are not served by them as such
+	if e.Kind != HostKind || !e.Online {
+		return e
+	}
+
+	e.Sessions = 1 + len(host.Standby)
+	if pool, ok := host.Routable.(*Pool); ok {
+		e.Sessions = len(pool.Members) + len(host.Standby)
+	}
+
+	return e
+}
+
+// Stats summarizes the routing table
+type Stats struct {
+	Hosts   int
+	Online  int
+	Offline int
+
+	// Sessions is the number of sessions serving online hosts
+	Sessions int
+
+	Names     int
+	Wildcards int
+	Pending   int
+	Paths     int
+
+	Accounts int
+}
+
+// Stats returns a summary of the routing table
+func (r *Router) Stats() Stats {
+	var s Stats
+
+	for _, e := range r.List(Filter{}) {
+		switch e.Kind {
+		case HostKind:
+			s.Hosts++
+			s.Sessions += e.Sessions
+
+			if e.Online {
+				s.Online++
+			} else {
+				s.Offline++
+			}
+		case NameKind:
+			s.Names++
+
+			if IsWildcard(e.FQDN) {
+				s.Wildcards++
+			}
+
+			if e.Pending {
+				s.Pending++
+			}
+		case PathKind:
+			s.Paths++
+		}
+	}
+
+	r.accountsLock.RLock()
+	s.Accounts = len(r.accounts)
+	r.accountsLock.RUnlock()
+
+	return s
+}
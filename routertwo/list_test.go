@@ -0,0 +1,58 @@
+package routertwo
+
+import (
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	r := newTestRouter(t, t.TempDir())
+
+	online := &OtherRoutable{name: "online.remote.moe"}
+	offline := &OtherRoutable{name: "offline.remote.moe"}
+	r.Online(online)
+	r.Online(offline)
+	r.Offline(offline)
+
+	r.OnlineStandby(&OtherRoutable{name: "online.remote.moe"})
+
+	for name, owner := range map[string]Routable{"*.foo.com": online, "bar.remote.moe": offline} {
+		err := r.AddName(NewName(name, owner))
+		if err != nil {
+			t.Fatalf("unable to add name: %s", err)
+		}
+	}
+
+	p, _ := NewPath("site.remote.moe/api", online)
+	r.AddPath(p)
+
+	entries := r.List(Filter{Kind: HostKind, Online: true})
+	if len(entries) != 1 || entries[0].FQDN != "online.remote.moe" || entries[0].Sessions != 2 {
+		t.Fatalf("unexpected online hosts: %+v", entries)
+	}
+
+	entries = r.List(Filter{Name: "*.foo.com"})
+	if len(entries) != 1 || entries[0].Owner != online.FQDN() || !entries[0].Online {
+		t.Fatalf("unexpected owner of *.foo.com: %+v", entries)
+	}
+
+	entries = r.List(Filter{Owner: offline.FQDN()})
+	if len(entries) != 2 || entries[0].FQDN != "bar.remote.moe" || entries[0].Online || entries[0].LastSeen.IsZero() {
+		t.Fatalf("unexpected entries of offline: %+v", entries)
+	}
+
+	entries = r.List(Filter{Offline: true, Kind: NameKind})
+	if len(entries) != 1 || entries[0].FQDN != "bar.remote.moe" {
+		t.Fatalf("unexpected offline names: %+v", entries)
+	}
+
+	entries = r.List(Filter{Kind: PathKind})
+	if len(entries) != 1 || entries[0].Target != online.FQDN() {
+		t.Fatalf("unexpected paths: %+v", entries)
+	}
+
+	stats := r.Stats()
+	expected := Stats{Hosts: 2, Online: 1, Offline: 1, Sessions: 2, Names: 2, Wildcards: 1, Paths: 1}
+	if stats != expected {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
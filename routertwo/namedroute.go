@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"time"
 )
 
 // NamedRoute implements Routable and is used when people want to create
@@ -13,9 +14,22 @@ type NamedRoute struct {
 	// Name, the FQDN
 	Name string
 
-	// Owner's pubkey fingerprint
+	// Owner's pubkey fingerprint, or the id of the owner's account
 	Owner string
 
+	// Target is the pubkey FQDN this name routes to, names from before accounts
+	// existed does not have one, and routes to their Owner
+	Target string
+
+	// Pending names are not routed until their owner have proven control over them
+	Pending bool
+
+	// Expires is when the name is removed, names without one lives on until removed by their owner
+	Expires time.Time
+
+	// Balance makes the name a pool of every key of its owner, connections are distributed between them
+	Balance Balance
+
 	// A namedroute must know the router it was added to
 	// in order to pass DialContext calls when Dialed
 	router *Router
@@ -27,8 +41,9 @@ func NewName(s string, r Routable) *NamedRoute {
 	s = strings.ToLower(s)
 
 	return &NamedRoute{
-		Owner: r.FQDN(),
-		Name:  s,
+		Owner:  r.FQDN(),
+		Target: r.FQDN(),
+		Name:   s,
 	}
 }
 
@@ -44,14 +59,39 @@ func (n *NamedRoute) DialContext(ctx context.Context, network, address string) (
 		return nil, fmt.Errorf("NamedRoute: cannot split host from port on '%s': %w", address, err)
 	}
 
-	address = net.JoinHostPort(n.Owner, p)
+	if n.Pending {
+		return nil, fmt.Errorf("%w: %s", ErrPending, n.Name)
+	}
+
+	// the router removes expired names periodically, they should not work in the meantime
+	if n.expired(time.Now()) {
+		return nil, fmt.Errorf("%s has expired", n.Name)
+	}
+
+	if n.Balance != "" {
+		return n.router.balance(ctx, n.Name, n.Balance, n.router.members(n.router.keysOf(n.Owner)), network, p)
+	}
+
+	address = net.JoinHostPort(n.target(), p)
 
 	return n.router.DialContext(ctx, network, address)
 }
 
-// Replaced for NamedRoutes means deleting the NamedRoute for good and really should not
-// happen - only in the case that a user tries to steal another users pubkey.hostname name -
-// an when the guy with the actural key comes online - this Replaced is called which will remove it from the database
+func (n *NamedRoute) expired(now time.Time) bool {
+	return !n.Expires.IsZero() && !n.Expires.After(now)
+}
+
+func (n *NamedRoute) target() string {
+	if n.Target == "" {
+		return n.Owner
+	}
+
+	return n.Target
+}
+
+// Replaced for NamedRoutes means the NamedRoute have been deleted for good, which only happens when
+// a user added a name that turned out to be another users pubkey hostname - and the user with the actual key
+// came online. By the time Replaced is called, the router have already removed it - we just let the owner know
 func (n *NamedRoute) Replaced() {
-	panic("fix me")
+	n.router.notify(n.Owner, fmt.Sprintf("%s was removed, the key it belongs to came online", n.Name))
 }
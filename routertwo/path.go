@@ -0,0 +1,424 @@
+package routertwo
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// PathRoute routes requests below a path prefix of a hostname, e.g. example.remote.moe/api, to a key.
+// Path routes are only used for http(s), where the path of requests is known
+type PathRoute struct {
+	// Name is the hostname
+	Name string
+
+	// Prefix is the path prefix, e.g. /api - matching whole path segments only
+	Prefix string
+
+	// Owner's pubkey fingerprint, or the id of the owner's account
+	Owner string
+
+	// Target is the pubkey FQDN requests are routed to
+	Target string
+
+	// Pending routes are not routed until their owner have proven control over the hostname
+	Pending bool
+
+	router *Router
+}
+
+// NewPath sets up and returns a *PathRoute which can be added to the router, s is a hostname
+// followed by a path, e.g. example.remote.moe/api
+func NewPath(s string, r Routable) (*PathRoute, error) {
+	i := strings.IndexByte(s, '/')
+	if i == -1 {
+		return nil, fmt.Errorf("%s does not contain a path", s)
+	}
+
+	p := path.Clean(s[i:])
+	if strings.ContainsAny(p, "?#") {
+		return nil, fmt.Errorf("%s is not a plain path", p)
+	}
+
+	return &PathRoute{
+		Name:   strings.ToLower(s[:i]),
+		Prefix: p,
+		Owner:  r.FQDN(),
+		Target: r.FQDN(),
+	}, nil
+}
+
+// IsPath reports whether s is a hostname followed by a path
+func IsPath(s string) bool {
+	return strings.Contains(s, "/")
+}
+
+// FQDN returns the hostname and prefix of the route, which is how path routes are found in the router
+func (p *PathRoute) FQDN() string {
+	return p.Name + p.Prefix
+}
+
+// DialContext dials the target of the route
+func (p *PathRoute) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if p.Pending {
+		return nil, fmt.Errorf("%w: %s", ErrPending, p.FQDN())
+	}
+
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("PathRoute: cannot split host from port on '%s': %w", address, err)
+	}
+
+	return p.router.DialContext(ctx, network, net.JoinHostPort(p.Target, port))
+}
+
+// Replaced for PathRoutes does nothing, they are never replaced
+func (p *PathRoute) Replaced() {}
+
+// record is the name path routes are stored by, paths contains slashes
+func (p *PathRoute) record() string {
+	return url.PathEscape(p.FQDN())
+}
+
+// claim returns the hostname of the route as a name, it is the hostname that gets verified
+func (p *PathRoute) claim() *NamedRoute {
+	return &NamedRoute{Name: p.Name, Owner: p.Owner, Target: p.Target, Pending: p.Pending}
+}
+
+// Route returns the key that should handle requests for host and path - path routes with the
+// longest matching prefix wins. Route returns false if host does not have any path routes matching path
+func (r *Router) Route(host, p string) (string, bool) {
+	table := r.table()
+
+	p = path.Clean("/" + p)
+	for {
+		if pr, exists := table[host+p].(*PathRoute); exists && !pr.Pending {
+			return pr.Target, true
+		}
+
+		if p == "/" {
+			return "", false
+		}
+
+		p = p[:strings.LastIndexByte(p, '/')]
+		if p == "" {
+			p = "/"
+		}
+	}
+}
+
+// pathsOf returns the path routes of host, the returned slice is never changed and can be read without locking
+func (r *Router) pathsOf(host string) []*PathRoute {
+	r.pathsLock.RLock()
+	defer r.pathsLock.RUnlock()
+
+	return r.pathIndex[host]
+}
+
+// indexPath adds p to the path index
+func (r *Router) indexPath(p *PathRoute) {
+	r.pathsLock.Lock()
+	defer r.pathsLock.Unlock()
+
+	// readers may be holding the slice, so appending must never write into it
+	paths := r.pathIndex[p.Name]
+	r.pathIndex[p.Name] = append(paths[:len(paths):len(paths)], p)
+	r.pathCount[p.Owner]++
+}
+
+// reducePathIndex removes p from the path index
+func (r *Router) reducePathIndex(p *PathRoute) {
+	r.pathsLock.Lock()
+	defer r.pathsLock.Unlock()
+
+	paths := r.pathIndex[p.Name]
+	kept := make([]*PathRoute, 0, len(paths))
+	for _, existing := range paths {
+		if existing != p {
+			kept = append(kept, existing)
+		}
+	}
+
+	if len(kept) == len(paths) {
+		return
+	}
+
+	if len(kept) == 0 {
+		delete(r.pathIndex, p.Name)
+	} else {
+		r.pathIndex[p.Name] = kept
+	}
+
+	r.pathCount[p.Owner]--
+	if r.pathCount[p.Owner] <= 0 {
+		delete(r.pathCount, p.Owner)
+	}
+}
+
+// putPath puts p in next and the path index, in place of any path route with the same hostname and prefix
+func (r *Router) putPath(next map[string]Routable, p *PathRoute) {
+	if existing, ok := next[p.FQDN()].(*PathRoute); ok {
+		r.reducePathIndex(existing)
+	}
+
+	r.indexPath(p)
+	next[p.FQDN()] = p
+}
+
+// dropPath removes p from next and the path index
+func (r *Router) dropPath(next map[string]Routable, p *PathRoute) {
+	r.reducePathIndex(p)
+	delete(next, p.FQDN())
+}
+
+// hasPaths reports whether there are any path routes for host, and whether any of them are verified
+func (r *Router) hasPaths(host string) (bool, bool) {
+	paths := r.pathsOf(host)
+
+	var active bool
+	for _, p := range paths {
+		active = active || !p.Pending
+	}
+
+	return len(paths) > 0, active
+}
+
+// othersPaths reports whether host have path routes owned by someone else than owner.
+// Paths pending verification does not keep verified claims from the hostname
+func (r *Router) othersPaths(host, owner string, verified bool) bool {
+	for _, p := range r.pathsOf(host) {
+		if p.Owner == owner {
+			continue
+		}
+
+		if !verified || !p.Pending {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verifiedHost reports whether owner have already verified host, by a name or another path of it
+func (r *Router) verifiedHost(next map[string]Routable, host, owner string) bool {
+	if n, ok := next[host].(*NamedRoute); ok && n.Owner == owner && !n.Pending {
+		return true
+	}
+
+	for _, p := range r.pathsOf(host) {
+		if p.Owner == owner && !p.Pending {
+			return true
+		}
+	}
+
+	return false
+}
+
+// used returns how many hostnames owner have, names and paths alike
+func (r *Router) used(owner string) int {
+	return len(r.nameIndex[owner]) + r.pathCount[owner]
+}
+
+// displacePaths removes path routes of host pending verification, which are not owned by owner
+func (r *Router) displacePaths(next map[string]Routable, host, owner string) ([]*PathRoute, error) {
+	displaced := make([]*PathRoute, 0)
+	for _, p := range r.pathsOf(host) {
+		if p.Owner == owner || !p.Pending {
+			continue
+		}
+
+		err := r.unlink(p.record())
+		if err != nil {
+			return displaced, err
+		}
+
+		r.dropPath(next, p)
+
+		displaced = append(displaced, p)
+	}
+
+	return displaced, nil
+}
+
+// evictPaths removes path routes of a key's hostname, which are not owned by the key, remove is called
+// with the record of every evicted path
+func (r *Router) evictPaths(next map[string]Routable, host string, remove func(string) error) ([]*PathRoute, error) {
+	owner := r.ownerOf(host)
+
+	evicted := make([]*PathRoute, 0)
+	for _, p := range r.pathsOf(host) {
+		if p.Owner == owner {
+			continue
+		}
+
+		err := remove(p.record())
+		if err != nil {
+			return evicted, err
+		}
+
+		r.dropPath(next, p)
+
+		evicted = append(evicted, p)
+	}
+
+	return evicted, nil
+}
+
+// AddPath adds a *PathRoute to the router. The hostname of the route must not be taken by anyone else,
+// but prefixes of the same hostname can belong to different owners
+func (r *Router) AddPath(p *PathRoute) error {
+	err := ValidateName(p.Name)
+	if err != nil {
+		return err
+	}
+
+	if IsWildcard(p.Name) {
+		return fmt.Errorf("%w: paths cannot be added to wildcards", ErrInvalidName)
+	}
+
+	if r.isReserved(p.Name) {
+		return fmt.Errorf("%w: %s is not available", ErrReservedName, p.Name)
+	}
+
+	// verification involves dns lookups, which should not hold up other editors
+	p.Pending = r.pending(p.claim())
+
+	next := r.begin()
+	defer r.finish()
+
+	p.Owner = r.ownerOf(p.Target)
+
+	// hostnames of keys are kept for the keys, even before they have been seen
+	if r.isKeyName(p.Name) && r.ownerOf(p.Name) != p.Owner {
+		return fmt.Errorf("%w: %s is the hostname of a key", ErrReservedName, p.Name)
+	}
+
+	// owners only verify a hostname once, for all of its paths
+	if p.Pending && r.verifiedHost(next, p.Name, p.Owner) {
+		p.Pending = false
+	}
+
+	if rtbl, exists := next[p.Name]; exists && r.owner(rtbl) != p.Owner {
+		return fmt.Errorf("%s belongs to someone else", p.Name)
+	}
+
+	if rtbl, shadows := r.shadowed(next, p.claim()); shadows {
+		return fmt.Errorf("%s is covered by %s which belongs to someone else", p.Name, rtbl.FQDN())
+	}
+
+	existing, exists := next[p.FQDN()].(*PathRoute)
+	if exists && existing.Owner != p.Owner && (p.Pending || !existing.Pending) {
+		return fmt.Errorf("%s is occupied", p.FQDN())
+	}
+
+	// adding a path again does not use more of the quota
+	replacing := exists && existing.Owner == p.Owner
+	if !replacing && r.maxNames > 0 && r.used(p.Owner) >= r.maxNames {
+		return fmt.Errorf("%w: you already have %d hostnames", ErrQuota, r.maxNames)
+	}
+
+	displaced := make([]*PathRoute, 0)
+	if !p.Pending {
+		displaced, err = r.displacePaths(next, p.Name, p.Owner)
+		if err != nil {
+			return fmt.Errorf("unable to remove pending paths: %w", err)
+		}
+	}
+
+	p.router = r
+
+	err = r.store(p.record(), &Intermediate{PathRoute: p})
+	if err != nil {
+		return fmt.Errorf("unable to store route: %w", err)
+	}
+
+	r.putPath(next, p)
+
+	r.exchange(next)
+
+	for _, d := range displaced {
+		r.emit(NameRemoved, d)
+		r.notify(d.Owner, fmt.Sprintf("%s was claimed by someone else before it was verified", d.FQDN()))
+	}
+
+	r.emit(NameAdded, p)
+
+	return nil
+}
+
+// RemovePath removes the path route s, e.g. example.remote.moe/api, if it is owned by from
+func (r *Router) RemovePath(s string, from Routable) error {
+	p, err := NewPath(s, from)
+	if err != nil {
+		return err
+	}
+
+	next := r.begin()
+	defer r.finish()
+
+	existing, exists := next[p.FQDN()].(*PathRoute)
+	if !exists {
+		return fmt.Errorf("%s does not exist", p.FQDN())
+	}
+
+	if existing.Owner != r.ownerOf(from.FQDN()) {
+		return fmt.Errorf("%s is not your route to remove", p.FQDN())
+	}
+
+	err = r.unlink(existing.record())
+	if err != nil {
+		return fmt.Errorf("fs error: %w", err)
+	}
+
+	r.dropPath(next, existing)
+
+	r.exchange(next)
+
+	r.emit(NameRemoved, existing)
+
+	return nil
+}
+
+// Paths returns the path routes of rtbl, sorted by hostname and prefix
+func (r *Router) Paths(rtbl Routable) []PathRoute {
+	owner := r.ownerOf(rtbl.FQDN())
+
+	paths := make([]PathRoute, 0)
+	for _, route := range r.table() {
+		if p, ok := route.(*PathRoute); ok && p.Owner == owner {
+			paths = append(paths, *p)
+		}
+	}
+
+	sort.Slice(paths, func(i, j int) bool {
+		return paths[i].FQDN() < paths[j].FQDN()
+	})
+
+	return paths
+}
+
+// removePaths removes every path route of owner from next
+func (r *Router) removePaths(next map[string]Routable, owner string) ([]Routable, error) {
+	removed := make([]Routable, 0)
+	for _, rtbl := range next {
+		p, ok := rtbl.(*PathRoute)
+		if !ok || p.Owner != owner {
+			continue
+		}
+
+		err := r.unlink(p.record())
+		if err != nil {
+			return removed, err
+		}
+
+		r.dropPath(next, p)
+
+		removed = append(removed, p)
+	}
+
+	return removed, nil
+}
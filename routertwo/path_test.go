@@ -0,0 +1,281 @@
+package routertwo
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPaths(t *testing.T) {
+	d := t.TempDir()
+	r := newTestRouter(t, d)
+
+	frontend := &OtherRoutable{name: "frontend.remote.moe"}
+	backend := &OtherRoutable{name: "backend.remote.moe"}
+	r.Online(frontend)
+	r.Online(backend)
+
+	for s, rtbl := range map[string]Routable{"preview.remote.moe/": frontend, "preview.remote.moe/api/": backend} {
+		p, err := NewPath(s, rtbl)
+		if err != nil {
+			t.Fatalf("unable to parse path: %s", err)
+		}
+
+		err = r.AddPath(p)
+		if err != nil {
+			t.Fatalf("unable to add path: %s", err)
+		}
+	}
+
+	p, _ := NewPath("preview.remote.moe/api", frontend)
+	err := r.AddPath(p)
+	if err == nil {
+		t.Fatalf("frontend was able to take the path of backend")
+	}
+
+	// path routes does not make hostnames routable for other protocols
+	err = r.AddName(NewName("preview.remote.moe", frontend))
+	if err == nil {
+		t.Fatalf("frontend was able to add a hostname with paths of others")
+	}
+
+	// but the hostname exists, e.g. for certificates
+	err = r.Exists(context.TODO(), "preview.remote.moe")
+	if err != nil {
+		t.Fatalf("expected hostname of paths to exist: %s", err)
+	}
+
+	routes := map[string]string{
+		"/":           frontend.FQDN(),
+		"":            frontend.FQDN(),
+		"/index.html": frontend.FQDN(),
+		"/apidocs":    frontend.FQDN(),
+		"/api":        backend.FQDN(),
+		"/api/":       backend.FQDN(),
+		"/api/v1/foo": backend.FQDN(),
+	}
+
+	// paths survives restarts
+	r = newTestRouter(t, d)
+
+	for path, expected := range routes {
+		target, found := r.Route("preview.remote.moe", path)
+		if !found || target != expected {
+			t.Fatalf("expected %s to be routed to %s, got %s", path, expected, target)
+		}
+	}
+
+	_, found := r.Route("other.remote.moe", "/")
+	if found {
+		t.Fatalf("other.remote.moe should not have any paths")
+	}
+
+	paths := r.Paths(backend)
+	if len(paths) != 1 || paths[0].FQDN() != "preview.remote.moe/api" {
+		t.Fatalf("unexpected paths: %+v", paths)
+	}
+
+	err = r.RemovePath("preview.remote.moe/api", frontend)
+	if err == nil {
+		t.Fatalf("frontend was able to remove the path of backend")
+	}
+
+	err = r.RemovePath("preview.remote.moe/api", backend)
+	if err != nil {
+		t.Fatalf("unable to remove path: %s", err)
+	}
+
+	target, _ := r.Route("preview.remote.moe", "/api/v1")
+	if target != frontend.FQDN() {
+		t.Fatalf("expected /api to fall back to frontend, got %s", target)
+	}
+
+	err = r.AddName(NewName("preview.remote.moe", frontend))
+	if err != nil {
+		t.Fatalf("unable to add hostname along side own paths: %s", err)
+	}
+}
+
+func TestPendingPaths(t *testing.T) {
+	dns := newDNSStandIn(t)
+	verifier := &Verifier{Resolver: NewResolver(dns.conn.LocalAddr().String()), Domain: "remote.moe"}
+
+	r := newTestRouter(t, t.TempDir(), WithVerifier(verifier), WithMaxNames(2))
+
+	owner := &OtherRoutable{name: "owner.remote.moe"}
+	squatter := &OtherRoutable{name: "squatter.remote.moe"}
+	r.Online(owner)
+	r.Online(squatter)
+
+	// paths outside remotemoe's own domain, are pending just like names
+	p, _ := NewPath("example.com/api", squatter)
+	err := r.AddPath(p)
+	if err != nil || !p.Pending {
+		t.Fatalf("expected example.com/api to be pending: %s", err)
+	}
+
+	_, found := r.Route("example.com", "/api")
+	if found {
+		t.Fatalf("pending paths must not be routed")
+	}
+
+	err = r.Exists(context.TODO(), "example.com")
+	if !errors.Is(err, ErrPending) {
+		t.Fatalf("expected pending error, got: %s", err)
+	}
+
+	// and does not keep the rightful owner from claiming the hostname
+	dns.set("_remotemoe.example.com", "owner")
+
+	err = r.AddName(NewName("example.com", owner))
+	if err != nil {
+		t.Fatalf("rightful owner was unable to claim hostname: %s", err)
+	}
+
+	if len(r.Paths(squatter)) != 0 {
+		t.Fatalf("squatter still has paths: %+v", r.Paths(squatter))
+	}
+
+	// verified hostnames verifies every path of it
+	dns.set("_remotemoe.example.com")
+
+	p, _ = NewPath("example.com/api", owner)
+	err = r.AddPath(p)
+	if err != nil || p.Pending {
+		t.Fatalf("expected example.com/api to be active: %s", err)
+	}
+
+	// paths counts towards the quota, adding one again does not
+	err = r.AddPath(p)
+	if err != nil {
+		t.Fatalf("unable to add path again: %s", err)
+	}
+
+	used, _ := r.Quota(owner)
+	if used != 2 {
+		t.Fatalf("expected 2 hostnames to be used, got %d", used)
+	}
+
+	p, _ = NewPath("example.com/docs", owner)
+	err = r.AddPath(p)
+	if !errors.Is(err, ErrQuota) {
+		t.Fatalf("expected quota error, got: %s", err)
+	}
+
+	// pending paths are activated as their hostname is verified
+	p, _ = NewPath("shop.example.com/", squatter)
+	err = r.AddPath(p)
+	if err != nil || !p.Pending {
+		t.Fatalf("expected shop.example.com/ to be pending: %s", err)
+	}
+
+	dns.set("_remotemoe.shop.example.com", "squatter")
+	r.VerifyPending()
+
+	target, found := r.Route("shop.example.com", "/index.html")
+	if !found || target != squatter.FQDN() {
+		t.Fatalf("expected shop.example.com to be routed to squatter, got %s", target)
+	}
+
+	err = r.Exists(context.TODO(), "shop.example.com")
+	if err != nil {
+		t.Fatalf("expected verified hostname of paths to exist: %s", err)
+	}
+}
+
+func TestKeyPaths(t *testing.T) {
+	r := newTestRouter(t, t.TempDir(), WithKeyDomain("remote.moe"))
+
+	squatter := &OtherRoutable{name: "squatter.remote.moe"}
+	r.Online(squatter)
+
+	// hostnames of keys are refused, even before the key have been seen
+	key := &OtherRoutable{name: "mfrggzdfmztwq2lknnwg23tpobyxe43uov3ho6dzpiytembrgiza.remote.moe"}
+
+	p, _ := NewPath(key.FQDN()+"/", squatter)
+	err := r.AddPath(p)
+	if !errors.Is(err, ErrReservedName) {
+		t.Fatalf("expected reserved error, got: %s", err)
+	}
+
+	// hostnames which only looks somewhat like keys, are not
+	p, _ = NewPath("mfrggzdfmztwq2lknnwg23tpobyxe43uov3ho6dzpiytembrgiza.example.com/", squatter)
+	err = r.AddPath(p)
+	if err != nil {
+		t.Fatalf("unable to add path: %s", err)
+	}
+
+	// keys may have paths on their own hostname
+	r.Online(key)
+
+	p, _ = NewPath(key.FQDN()+"/api", key)
+	err = r.AddPath(p)
+	if err != nil {
+		t.Fatalf("key was unable to add path on its own hostname: %s", err)
+	}
+
+	// keys not looking like keys are not protected up front, but take their hostname back when online
+	victim := &OtherRoutable{name: "victim.remote.moe"}
+
+	p, _ = NewPath("victim.remote.moe/", squatter)
+	err = r.AddPath(p)
+	if err != nil {
+		t.Fatalf("unable to add path: %s", err)
+	}
+
+	r.Online(victim)
+
+	_, found := r.Route("victim.remote.moe", "/")
+	if found {
+		t.Fatalf("path of squatter survived the key coming online")
+	}
+
+	if len(r.Paths(squatter)) != 1 {
+		t.Fatalf("expected squatter to have a single path left, got %+v", r.Paths(squatter))
+	}
+
+	used, _ := r.Quota(squatter)
+	if used != 1 {
+		t.Fatalf("expected 1 hostname to be used, got %d", used)
+	}
+}
+
+func TestWildcardPaths(t *testing.T) {
+	r := newTestRouter(t, t.TempDir())
+
+	owner := &OtherRoutable{name: "owner.remote.moe"}
+	other := &OtherRoutable{name: "other.remote.moe"}
+	r.Online(owner)
+	r.Online(other)
+
+	err := r.AddName(NewName("*.mybranch.example.com", owner))
+	if err != nil {
+		t.Fatalf("unable to add wildcard: %s", err)
+	}
+
+	// paths cannot be added inside the wildcard of someone else
+	p, _ := NewPath("shop.mybranch.example.com/api", other)
+	err = r.AddPath(p)
+	if err == nil {
+		t.Fatalf("other was able to add a path inside the wildcard of owner")
+	}
+
+	// but the owner of the wildcard can
+	p, _ = NewPath("shop.mybranch.example.com/api", owner)
+	err = r.AddPath(p)
+	if err != nil {
+		t.Fatalf("unable to add path inside own wildcard: %s", err)
+	}
+
+	// and wildcards cannot cover paths of someone else
+	p, _ = NewPath("shop.example.org/", other)
+	err = r.AddPath(p)
+	if err != nil {
+		t.Fatalf("unable to add path: %s", err)
+	}
+
+	err = r.AddName(NewName("*.example.org", owner))
+	if err == nil {
+		t.Fatalf("owner was able to add a wildcard covering the path of other")
+	}
+}
@@ -0,0 +1,279 @@
+package routertwo
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Balance decides how connections are distributed between members of a pool
+type Balance string
+
+const (
+	// RoundRobin takes turns between members
+	RoundRobin Balance = "round-robin"
+
+	// LeastConn picks the member with the fewest open connections
+	LeastConn Balance = "least-conn"
+)
+
+// ParseBalance returns the Balance named s
+func ParseBalance(s string) (Balance, error) {
+	switch Balance(s) {
+	case RoundRobin, LeastConn:
+		return Balance(s), nil
+	}
+
+	return "", fmt.Errorf("unknown balance %q, use %s or %s", s, RoundRobin, LeastConn)
+}
+
+// Pool is a group of sessions sharing the same key, connections are distributed between them.
+// Pools are never changed once created, the router creates a new pool when members join or leave
+type Pool struct {
+	Name    string
+	Balance Balance
+	Members []Routable
+
+	router *Router
+}
+
+// FQDN returns the fully qualified domain name of the pool
+func (p *Pool) FQDN() string {
+	return p.Name
+}
+
+// DialContext dials one of the members of the pool
+func (p *Pool) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("Pool: cannot split host from port on '%s': %w", address, err)
+	}
+
+	return p.router.balance(ctx, p.Name, p.Balance, p.Members, network, port)
+}
+
+// Replaced replaces every member of the pool
+func (p *Pool) Replaced() {
+	for _, m := range p.Members {
+		m.Replaced()
+	}
+}
+
+// Notify passes msg on to every member of the pool able to receive it
+func (p *Pool) Notify(msg string) {
+	for _, m := range p.Members {
+		if notifier, ok := m.(Notifier); ok {
+			notifier.Notify(msg)
+		}
+	}
+}
+
+// with returns a copy of the pool including rtbl
+func (p *Pool) with(rtbl Routable) *Pool {
+	members := make([]Routable, 0, len(p.Members)+1)
+	members = append(members, p.Members...)
+	members = append(members, rtbl)
+
+	return &Pool{Name: p.Name, Balance: p.Balance, Members: members, router: p.router}
+}
+
+// without returns a copy of the pool excluding rtbl, and whether rtbl was a member
+func (p *Pool) without(rtbl Routable) (*Pool, bool) {
+	members := make([]Routable, 0, len(p.Members))
+	for _, m := range p.Members {
+		if m != rtbl {
+			members = append(members, m)
+		}
+	}
+
+	return &Pool{Name: p.Name, Balance: p.Balance, Members: members, router: p.router}, len(members) != len(p.Members)
+}
+
+// balancer keeps track of turns and open connections, for pools and pooled names
+type balancer struct {
+	// turns holds a counter per pool, used when taking turns
+	turns sync.Map
+
+	// active holds the number of open connections per member
+	active sync.Map
+}
+
+func (b *balancer) turn(name string) uint64 {
+	c, _ := b.turns.LoadOrStore(name, new(uint64))
+	return atomic.AddUint64(c.(*uint64), 1)
+}
+
+func (b *balancer) counter(m Routable) *int64 {
+	c, _ := b.active.LoadOrStore(m, new(int64))
+	return c.(*int64)
+}
+
+// forget removes the counters of m, which have left for good - pools take their members with them
+func (b *balancer) forget(m Routable) {
+	if pool, ok := m.(*Pool); ok {
+		for _, member := range pool.Members {
+			b.active.Delete(member)
+		}
+	}
+
+	b.active.Delete(m)
+	b.turns.Delete(m.FQDN())
+}
+
+// order returns members in the order they should be tried
+func (b *balancer) order(name string, balance Balance, members []Routable) []Routable {
+	// always start at a new member, so ties are broken by taking turns
+	start := int(b.turn(name) % uint64(len(members)))
+
+	ordered := make([]Routable, 0, len(members))
+	ordered = append(ordered, members[start:]...)
+	ordered = append(ordered, members[:start]...)
+
+	if balance == LeastConn {
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return atomic.LoadInt64(b.counter(ordered[i])) < atomic.LoadInt64(b.counter(ordered[j]))
+		})
+	}
+
+	return ordered
+}
+
+// balance dials port on members in the order of balance, the first member to answer is used
+func (r *Router) balance(ctx context.Context, name string, balance Balance, members []Routable, network, port string) (net.Conn, error) {
+	if len(members) == 0 {
+		return nil, fmt.Errorf("%w: %s has no members", ErrOffline, name)
+	}
+
+	var err error
+	for _, m := range r.balancer.order(name, balance, members) {
+		counter := r.balancer.counter(m)
+		atomic.AddInt64(counter, 1)
+
+		var conn net.Conn
+		conn, err = m.DialContext(ctx, network, net.JoinHostPort(m.FQDN(), port))
+		if err == nil {
+			return &countedConn{Conn: conn, counter: counter}, nil
+		}
+
+		atomic.AddInt64(counter, -1)
+
+		// the caller gave up, no need to try the rest
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, fmt.Errorf("no member of %s was able to connect: %w", name, err)
+}
+
+// countedConn counts down its members open connections when closed
+type countedConn struct {
+	net.Conn
+
+	counter *int64
+	once    sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() {
+		atomic.AddInt64(c.counter, -1)
+	})
+
+	return c.Conn.Close()
+}
+
+// OnlinePool is like Online, but rtbl joins other sessions with the same key in a pool instead of replacing them.
+// Sessions not in pool mode are replaced as usual, the balance of the first session of a pool is used by the pool
+func (r *Router) OnlinePool(rtbl Routable, balance Balance) (bool, error) {
+	next := r.begin()
+	defer r.finish()
+
+	// the first session of a pool takes over the route, like any other session
+	host, ok := next[rtbl.FQDN()].(*Host)
+	if !ok {
+		return r.online(next, &Pool{Name: rtbl.FQDN(), Balance: balance, Members: []Routable{rtbl}, router: r})
+	}
+
+	pool, ok := host.Routable.(*Pool)
+	if !ok {
+		return r.online(next, &Pool{Name: rtbl.FQDN(), Balance: balance, Members: []Routable{rtbl}, router: r})
+	}
+
+	// readers may be using the current host, so a new host with the new pool replaces it
+	host = &Host{
+		Routable: pool.with(rtbl),
+		Name:     host.Name,
+		Standby:  host.Standby,
+		Node:     host.Node,
+		LastSeen: host.LastSeen,
+		Created:  host.Created,
+	}
+
+	next[host.Name] = host
+
+	r.exchange(next)
+
+	r.emit(HostOnline, host)
+
+	return false, nil
+}
+
+// offlinePool removes rtbl from the pool of host, and reports whether rtbl was found
+func (r *Router) offlinePool(next map[string]Routable, host *Host, rtbl Routable) bool {
+	pool, ok := host.Routable.(*Pool)
+	if !ok {
+		return false
+	}
+
+	remaining, member := pool.without(rtbl)
+	if !member {
+		return false
+	}
+
+	r.balancer.forget(rtbl)
+
+	// the last member takes the host offline
+	if len(remaining.Members) == 0 {
+		r.offline(next, host)
+		return true
+	}
+
+	next[host.Name] = &Host{
+		Routable: remaining,
+		Name:     host.Name,
+		Standby:  host.Standby,
+		Node:     host.Node,
+		LastSeen: time.Now(),
+		Created:  host.Created,
+	}
+
+	r.exchange(next)
+
+	return true
+}
+
+// members returns every online session of keys
+func (r *Router) members(keys []string) []Routable {
+	table := r.table()
+
+	members := make([]Routable, 0, len(keys))
+	for _, key := range keys {
+		host, ok := table[key].(*Host)
+		if !ok || host.Routable == nil {
+			continue
+		}
+
+		if pool, ok := host.Routable.(*Pool); ok {
+			members = append(members, pool.Members...)
+			continue
+		}
+
+		members = append(members, host.Routable)
+	}
+
+	return members
+}
@@ -0,0 +1,204 @@
+package routertwo
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+// PooledRoutable counts dials and hands out pipes
+type PooledRoutable struct {
+	OtherRoutable
+
+	dials    int64
+	replaced int64
+}
+
+func (r *PooledRoutable) DialContext(_ context.Context, _, _ string) (net.Conn, error) {
+	atomic.AddInt64(&r.dials, 1)
+
+	c, _ := net.Pipe()
+	return c, nil
+}
+
+func (r *PooledRoutable) Replaced() {
+	atomic.AddInt64(&r.replaced, 1)
+}
+
+func TestPoolRoundRobin(t *testing.T) {
+	r := newTestRouter(t, t.TempDir())
+
+	a := &PooledRoutable{OtherRoutable: OtherRoutable{name: "pool.remote.moe"}}
+	b := &PooledRoutable{OtherRoutable: OtherRoutable{name: "pool.remote.moe"}}
+
+	for _, rtbl := range []Routable{a, b} {
+		replaced, err := r.OnlinePool(rtbl, RoundRobin)
+		if err != nil || replaced {
+			t.Fatalf("unexpected online result: %t %s", replaced, err)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		c, err := r.DialContext(context.TODO(), "tcp", "pool.remote.moe:80")
+		if err != nil {
+			t.Fatalf("unable to dial pool: %s", err)
+		}
+
+		c.Close()
+	}
+
+	if a.dials != 5 || b.dials != 5 {
+		t.Fatalf("expected dials to be distributed evenly, got %d and %d", a.dials, b.dials)
+	}
+
+	// members leave as they go offline
+	r.Offline(a)
+
+	for i := 0; i < 10; i++ {
+		c, err := r.DialContext(context.TODO(), "tcp", "pool.remote.moe:80")
+		if err != nil {
+			t.Fatalf("unable to dial pool: %s", err)
+		}
+
+		c.Close()
+	}
+
+	if a.dials != 5 || b.dials != 15 {
+		t.Fatalf("expected b to receive every dial, got %d and %d", a.dials, b.dials)
+	}
+
+	r.Offline(b)
+
+	_, err := r.DialContext(context.TODO(), "tcp", "pool.remote.moe:80")
+	if !errors.Is(err, ErrOffline) {
+		t.Fatalf("expected empty pool to be offline, got: %s", err)
+	}
+
+	// sessions not in pool mode replaces the pool
+	r.OnlinePool(a, RoundRobin)
+	r.OnlinePool(b, RoundRobin)
+
+	replaced, err := r.Online(&PooledRoutable{OtherRoutable: OtherRoutable{name: "pool.remote.moe"}})
+	if err != nil || !replaced {
+		t.Fatalf("expected pool to be replaced: %t %s", replaced, err)
+	}
+}
+
+func TestPoolLeastConn(t *testing.T) {
+	r := newTestRouter(t, t.TempDir())
+
+	a := &PooledRoutable{OtherRoutable: OtherRoutable{name: "pool.remote.moe"}}
+	b := &PooledRoutable{OtherRoutable: OtherRoutable{name: "pool.remote.moe"}}
+
+	r.OnlinePool(a, LeastConn)
+	r.OnlinePool(b, LeastConn)
+
+	// keep a few connections open, they should end up on both members
+	open := make([]net.Conn, 0)
+	for i := 0; i < 4; i++ {
+		c, err := r.DialContext(context.TODO(), "tcp", "pool.remote.moe:80")
+		if err != nil {
+			t.Fatalf("unable to dial pool: %s", err)
+		}
+
+		open = append(open, c)
+	}
+
+	if a.dials != 2 || b.dials != 2 {
+		t.Fatalf("expected open connections to be spread out, got %d and %d", a.dials, b.dials)
+	}
+
+	// closing connections of one member, makes it the preferred one
+	for _, c := range open {
+		c.Close()
+	}
+
+	c, err := r.DialContext(context.TODO(), "tcp", "pool.remote.moe:80")
+	if err != nil {
+		t.Fatalf("unable to dial pool: %s", err)
+	}
+	defer c.Close()
+
+	busy, idle := a, b
+	if b.dials > a.dials {
+		busy, idle = b, a
+	}
+
+	for i := 0; i < 3; i++ {
+		c, err := r.DialContext(context.TODO(), "tcp", "pool.remote.moe:80")
+		if err != nil {
+			t.Fatalf("unable to dial pool: %s", err)
+		}
+		defer c.Close()
+	}
+
+	if busy.dials != 4 || idle.dials != 4 {
+		t.Fatalf("expected least connections to be preferred, got %d and %d", busy.dials, idle.dials)
+	}
+}
+
+func TestNamedPool(t *testing.T) {
+	r := newTestRouter(t, t.TempDir())
+
+	a := &PooledRoutable{OtherRoutable: OtherRoutable{name: "a.remote.moe"}}
+	b := &PooledRoutable{OtherRoutable: OtherRoutable{name: "b.remote.moe"}}
+	r.Online(a)
+	r.Online(b)
+
+	r.Link(a, b.FQDN())
+	r.Link(b, a.FQDN())
+
+	n := NewName("replicas.remote.moe", a)
+	n.Balance = RoundRobin
+
+	err := r.AddName(n)
+	if err != nil {
+		t.Fatalf("unable to add name: %s", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		c, err := r.DialContext(context.TODO(), "tcp", "replicas.remote.moe:80")
+		if err != nil {
+			t.Fatalf("unable to dial pool: %s", err)
+		}
+
+		c.Close()
+	}
+
+	if a.dials != 5 || b.dials != 5 {
+		t.Fatalf("expected dials to be distributed between keys, got %d and %d", a.dials, b.dials)
+	}
+
+	r.Offline(a)
+
+	c, err := r.DialContext(context.TODO(), "tcp", "replicas.remote.moe:80")
+	if err != nil {
+		t.Fatalf("unable to dial pool: %s", err)
+	}
+
+	c.Close()
+
+	if b.dials != 6 {
+		t.Fatalf("expected b to receive the dial")
+	}
+
+	// sessions leaving, and names removed, does not leave counters behind
+	r.Offline(b)
+
+	err = r.RemoveName("replicas.remote.moe", b)
+	if err != nil {
+		t.Fatalf("unable to remove name: %s", err)
+	}
+
+	r.balancer.active.Range(func(m, _ interface{}) bool {
+		t.Fatalf("counter of %s was left behind", m.(Routable).FQDN())
+		return false
+	})
+
+	r.balancer.turns.Range(func(name, _ interface{}) bool {
+		t.Fatalf("turns of %s was left behind", name)
+		return false
+	})
+}
@@ -5,14 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/fs"
 	"log"
 	"net"
-	"os"
-	"path"
-	"path/filepath"
 	"sync"
-	"syscall"
+	"sync/atomic"
 	"time"
 )
 
@@ -32,68 +28,145 @@ type Routable interface {
 	Replaced()
 }
 
+// Notifier is implemented by Routables which are able to pass messages on to their user
+type Notifier interface {
+	Notify(msg string)
+}
+
 // Router - takes care of Routable and Namedroutes
 type Router struct {
-	sync.RWMutex
-
-	dbPath string
+	db Store
 
-	editLock sync.Mutex
-	a        *map[string]Routable
-	b        *map[string]Routable
-	active   *map[string]Routable
+	// routes holds the current routing table, a map[string]Routable. A stored table is never
+	// modified - editors copy it, make their changes to the copy and store that instead,
+	// which leaves readers free to look up routes without ever waiting for an editor
+	routes atomic.Value
 
+	// editLock serializes editors, and guards nameIndex
+	editLock  sync.Mutex
 	nameIndex map[string][]*NamedRoute
+
+	// pathIndex holds the path routes of each hostname, and pathCount how many each owner have. They
+	// are only changed while holding editLock, pathsLock is for readers not holding it
+	pathsLock sync.RWMutex
+	pathIndex map[string][]*PathRoute
+	pathCount map[string]int
+
+	// quarantine moves records that cannot be parsed out of the way, instead of failing
+	quarantine bool
+
+	// reserved names cannot be added as NamedRoutes
+	reserved []string
+
+	// keyDomain is the domain keys are known by hostnames below, paths cannot be added to those hostnames
+	keyDomain string
+
+	// maxNames is how many NamedRoutes and PathRoutes each owner may have, zero means unlimited
+	maxNames int
+
+	// verifier, if set, keeps names pending until their owner have proven control over them
+	verifier *Verifier
+
+	// node is the name of this router in a cluster, changes are passed on to the cluster
+	node    string
+	cluster Cluster
+
+	// clock counts changes, versions holds the version of every record and tombstones the records removed
+	// within a cluster - they are guarded by editLock
+	clock      uint64
+	versions   map[string]Version
+	tombstones map[string]*Tombstone
+
+	// accounts are looked up by id and by the keys they contain. Accounts are only changed
+	// while holding editLock, accountsLock is for readers not holding it
+	accountsLock sync.RWMutex
+	accounts     map[string]*Account
+	keyAccounts  map[string]*Account
+
+	// linkRequests holds keys waiting for the key they want to link with, to ask for the same
+	linkRequests map[string]string
+
+	// transfers holds names offered to other keys, guarded by editLock
+	transfers map[string]transfer
+
+	balancer balancer
+
+	subscribersLock sync.Mutex
+	subscribers     map[chan Event]struct{}
 }
 
-// NewRouter initializes a new Router with a given path
-func NewRouter(dbPath string) (*Router, error) {
-	// make room for a and b lists
-	a := make(map[string]Routable)
-	b := make(map[string]Routable)
+// ErrQuota is returned when an owner tries to add more NamedRoutes than allowed
+var ErrQuota = errors.New("hostname quota exceeded")
 
-	r := &Router{
-		dbPath:    dbPath,
-		a:         &a,
-		b:         &b,
-		nameIndex: make(map[string][]*NamedRoute),
+// Option configures a Router as it is created by NewRouter
+type Option func(*Router)
+
+// WithQuarantine makes NewRouter quarantine records it cannot parse and continue
+// starting up, instead of refusing to start
+func WithQuarantine() Option {
+	return func(r *Router) {
+		r.quarantine = true
 	}
+}
 
-	r.active = r.a
+// WithMaxNames limits how many NamedRoutes and PathRoutes each owner may have
+func WithMaxNames(n int) Option {
+	return func(r *Router) {
+		r.maxNames = n
+	}
+}
 
-	err := filepath.WalkDir(dbPath, func(p string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
+// NewRouter initializes a new Router with the records found in db
+func NewRouter(db Store, opts ...Option) (*Router, error) {
+	routes := make(map[string]Routable)
 
-		if d.IsDir() {
-			return nil
+	r := &Router{
+		db:           db,
+		nameIndex:    make(map[string][]*NamedRoute),
+		pathIndex:    make(map[string][]*PathRoute),
+		pathCount:    make(map[string]int),
+		versions:     make(map[string]Version),
+		tombstones:   make(map[string]*Tombstone),
+		accounts:     make(map[string]*Account),
+		keyAccounts:  make(map[string]*Account),
+		linkRequests: make(map[string]string),
+		transfers:    make(map[string]transfer),
+		subscribers:  make(map[chan Event]struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	err := db.Walk(func(name string, data []byte) error {
+		i, routable, err := r.load(name, data)
+		if err != nil && r.quarantine {
+			log.Printf("router: quarantining %s: %s", name, err)
+			return db.Quarantine(name)
 		}
 
-		fd, err := os.Open(p)
 		if err != nil {
-			return fmt.Errorf("unable to open %s: %w", p, err)
+			return err
 		}
-		defer fd.Close()
 
-		dec := json.NewDecoder(fd)
-		var i Intermediate
-		err = dec.Decode(&i)
-		if err != nil {
-			return fmt.Errorf("unable to decode json (%s): %w", p, err)
+		r.remember(name, i)
+
+		if i.Account != nil {
+			r.setAccount(i.Account)
+			return nil
 		}
 
-		routable, err := i.Wake(r)
-		if err != nil {
-			return fmt.Errorf("json format error (%s): %w", p, err)
+		if i.Tombstone != nil {
+			return nil
 		}
 
-		a[routable.FQDN()] = routable
-		b[routable.FQDN()] = routable
+		routes[routable.FQDN()] = routable
 
-		nroute, ok := routable.(*NamedRoute)
-		if ok {
-			r.index(nroute)
+		switch route := routable.(type) {
+		case *NamedRoute:
+			r.index(route)
+		case *PathRoute:
+			r.indexPath(route)
 		}
 
 		return nil
@@ -103,9 +176,36 @@ func NewRouter(dbPath string) (*Router, error) {
 		return nil, fmt.Errorf("unable to bring router database up: %w", err)
 	}
 
+	r.routes.Store(routes)
+
 	return r, nil
 }
 
+func (r *Router) load(name string, data []byte) (*Intermediate, Routable, error) {
+	var i Intermediate
+	err := json.Unmarshal(data, &i)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to decode json (%s): %w", name, err)
+	}
+
+	// accounts and tombstones are not routable
+	if i.Account != nil || i.Tombstone != nil {
+		return &i, nil, nil
+	}
+
+	routable, err := i.Wake(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("json format error (%s): %w", name, err)
+	}
+
+	return &i, routable, nil
+}
+
+// Close closes the underlying Store
+func (r *Router) Close() error {
+	return r.db.Close()
+}
+
 // DialContext is used by stuff that what to dial something up
 func (r *Router) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
 	host, _, err := net.SplitHostPort(address)
@@ -113,42 +213,72 @@ func (r *Router) DialContext(ctx context.Context, network, address string) (net.
 		return nil, fmt.Errorf("router: could not split host from port: %w", err)
 	}
 
-	r.RLock()
-	d, exists := (*r.active)[host]
-	r.RUnlock()
+	d, exists := lookup(r.table(), host)
 
 	if !exists {
 		return nil, fmt.Errorf("%w: %s not found", ErrNotFound, host)
 	}
 
+	// names are dialed as the key they route to, the hostname first dialed is kept around
+	if Hostname(ctx) == "" {
+		ctx = WithHostname(ctx, host)
+	}
+
 	return d.DialContext(ctx, network, address)
 }
 
+type hostnameKey struct{}
+
+// WithHostname records name as the hostname being dialed in ctx
+func WithHostname(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, hostnameKey{}, name)
+}
+
+// Hostname returns the hostname originally dialed, before names were resolved to the keys they route to
+func Hostname(ctx context.Context) string {
+	name, _ := ctx.Value(hostnameKey{}).(string)
+	return name
+}
+
 // Online should only be used by peers, e.g. ssh clients which proved
 // by authentication that they do infact have the private key for their FQDN
 func (r *Router) Online(rtbl Routable) (bool, error) {
-	next, old := r.begin()
+	next := r.begin()
 	defer r.finish()
 
+	return r.online(next, rtbl)
+}
+
+// online takes over the route of rtbl in next, and exchanges next
+func (r *Router) online(next map[string]Routable, rtbl Routable) (bool, error) {
 	var host *Host
+	var squatter *NamedRoute
 	var replaced bool
-	oldRoute, exists := (*next)[rtbl.FQDN()]
+	oldRoute, exists := next[rtbl.FQDN()]
 	if exists { // route exists
 		var ok bool
 		host, ok = oldRoute.(*Host)
 		if ok { // route is host
 			go host.Replaced()
 			if host.Routable != nil {
+				r.balancer.forget(host.Routable)
 				replaced = true
 			}
 
 			host = &Host{
 				Routable: rtbl,
 				Name:     rtbl.FQDN(),
+				Standby:  host.Standby,
 				LastSeen: time.Now(),
 				Created:  host.Created,
 			}
 		} else { // if route was not host - just replace
+			// the route must have been a NamedRoute, taking up the name of this key,
+			// it will be overwritten on disk as the host is stored below
+			if n, ok := oldRoute.(*NamedRoute); ok {
+				squatter = n
+			}
+
 			host = &Host{
 				Routable: rtbl,
 				Name:     rtbl.FQDN(),
@@ -165,6 +295,9 @@ func (r *Router) Online(rtbl Routable) (bool, error) {
 		}
 	}
 
+	// other nodes of a cluster should know where to find this host
+	host.Node = r.node
+
 	// store this host on disk
 	i := &Intermediate{Host: host}
 	err := r.store(rtbl.FQDN(), i)
@@ -172,23 +305,47 @@ func (r *Router) Online(rtbl Routable) (bool, error) {
 		return false, fmt.Errorf("unable to store host: %w", err)
 	}
 
+	if squatter != nil {
+		r.reduceIndex(squatter.Owner, squatter)
+	}
+
+	// paths others have put on the hostname of the key, are removed just like squatting names
+	evicted, err := r.evictPaths(next, rtbl.FQDN(), r.unlink)
+	if err != nil {
+		return false, fmt.Errorf("unable to remove paths: %w", err)
+	}
+
 	// do the exchange
-	(*next)[rtbl.FQDN()] = host
+	next[rtbl.FQDN()] = host
 
 	r.exchange(next)
 
-	(*old)[rtbl.FQDN()] = host
+	if squatter != nil {
+		go squatter.Replaced()
+		r.emit(NameRemoved, squatter)
+	}
+
+	for _, p := range evicted {
+		r.emit(NameRemoved, p)
+		r.notify(p.Owner, fmt.Sprintf("%s was taken back by the key it belongs to", p.FQDN()))
+	}
+
+	if replaced {
+		r.emit(HostReplaced, host)
+	}
+
+	r.emit(HostOnline, host)
 
 	return replaced, nil
 }
 
 // Offline removes the routable from a host
 func (r *Router) Offline(d Routable) {
-	next, old := r.begin()
+	next := r.begin()
 	defer r.finish()
 
 	// we should be able to find this routable
-	routable, ok := (*r.active)[d.FQDN()]
+	routable, ok := next[d.FQDN()]
 	if !ok {
 		return
 	}
@@ -199,53 +356,134 @@ func (r *Router) Offline(d Routable) {
 		return
 	}
 
+	// sessions on standby just leaves
+	if r.offlineStandby(next, host, d) {
+		return
+	}
+
+	// pooled sessions leave their pool
+	if r.offlinePool(next, host, d) {
+		return
+	}
+
 	// and the host, should contain this actual routable
 	if d != host.Routable {
 		return
 	}
 
-	// change last seen and update record
-	host.LastSeen = time.Now()
+	r.offline(next, host)
+}
 
-	i := &Intermediate{Host: host}
-	err := r.store(host.FQDN(), i)
-	if err != nil {
-		// we need to continue even if we encounter this error
-		log.Printf("router: unable to update host as it went offline: %s", err)
+// offline takes host offline in next, and exchanges next
+func (r *Router) offline(next map[string]Routable, host *Host) {
+	if host.Routable != nil {
+		r.balancer.forget(host.Routable)
 	}
 
-	// we have to create a new Host and have the old one garbage collected
+	// sessions on standby takes over, instead of going offline
+	if len(host.Standby) > 0 {
+		r.promote(next, host)
+		return
+	}
+
+	// the current host may be in use by readers, so we create a new Host
+	// with an updated last seen and have the old one garbage collected
 	host = &Host{
 		Routable: nil,
 		Name:     host.Name,
-		LastSeen: host.LastSeen,
+		LastSeen: time.Now(),
 		Created:  host.Created,
 	}
 
+	i := &Intermediate{Host: host}
+	err := r.store(host.FQDN(), i)
+	if err != nil {
+		// we need to continue even if we encounter this error
+		log.Printf("router: unable to update host as it went offline: %s", err)
+	}
+
 	// do the exchange
-	(*next)[host.Name] = host
+	next[host.Name] = host
 
 	r.exchange(next)
 
-	(*old)[host.Name] = host
-
+	r.emit(HostOffline, host)
 }
 
 // AddName adds a *NamedRoute to the router
 func (r *Router) AddName(n *NamedRoute) error {
-	next, old := r.begin()
+	err := ValidateName(n.FQDN())
+	if err != nil {
+		return err
+	}
+
+	if r.isReserved(n.FQDN()) {
+		return fmt.Errorf("%w: %s is not available", ErrReservedName, n.FQDN())
+	}
+
+	// verification involves dns lookups, which should not hold up other editors
+	n.Pending = r.pending(n)
+
+	next := r.begin()
 	defer r.finish()
 
+	// names added by linked keys belong to their account
+	n.Owner = r.ownerOf(n.target())
+
 	// existing routes are handled differently
-	existing, exists := (*next)[n.FQDN()]
+	var displaced *NamedRoute
+	existing, exists := next[n.FQDN()]
 	if exists {
-		if existingNamedRoute, ok := existing.(*NamedRoute); ok {
-			if existingNamedRoute.Owner == n.Owner {
+		existingNamedRoute, ok := existing.(*NamedRoute)
+		if ok && existingNamedRoute.Owner == n.Owner && (!existingNamedRoute.Pending || n.Pending) {
+			n.Pending = existingNamedRoute.Pending
+
+			// adding a name again, renews or removes its expiry and balance
+			if existingNamedRoute.Expires.Equal(n.Expires) && existingNamedRoute.Balance == n.Balance {
 				return nil
 			}
+
+			err = r.replaceName(next, existingNamedRoute, func(renewed *NamedRoute) {
+				renewed.Expires = n.Expires
+				renewed.Balance = n.Balance
+			})
+
+			if err != nil {
+				return err
+			}
+
+			r.exchange(next)
+
+			return nil
+		}
+
+		// names pending verification does not keep verified claims from them, but the first pending claim stands
+		if !ok || !existingNamedRoute.Pending || n.Pending {
+			return fmt.Errorf("%s is occupied", n.FQDN())
 		}
 
-		return fmt.Errorf("%s is occupied", n.FQDN())
+		displaced = existingNamedRoute
+	}
+
+	names := r.used(n.Owner)
+	if displaced != nil && displaced.Owner == n.Owner {
+		names--
+	}
+
+	if r.maxNames > 0 && names >= r.maxNames {
+		return fmt.Errorf("%w: you already have %d hostnames", ErrQuota, r.maxNames)
+	}
+
+	if r.othersPaths(n.FQDN(), n.Owner, !n.Pending) {
+		return fmt.Errorf("%s has paths which belongs to someone else", n.FQDN())
+	}
+
+	if rtbl, shadows := r.shadowed(next, n); shadows {
+		if IsWildcard(n.FQDN()) {
+			return fmt.Errorf("%s covers %s which belongs to someone else", n.FQDN(), rtbl.FQDN())
+		}
+
+		return fmt.Errorf("%s is covered by %s which belongs to someone else", n.FQDN(), rtbl.FQDN())
 	}
 
 	// make sure this name is able to use us
@@ -253,18 +491,43 @@ func (r *Router) AddName(n *NamedRoute) error {
 
 	// handle new routes
 	i := &Intermediate{NamedRoute: n}
-	err := r.store(n.FQDN(), i)
+	err = r.store(n.FQDN(), i)
 	if err != nil {
 		return fmt.Errorf("unable to store route: %w", err)
 	}
 
+	displacedPaths := make([]*PathRoute, 0)
+	if !n.Pending {
+		displacedPaths, err = r.displacePaths(next, n.FQDN(), n.Owner)
+		if err != nil {
+			return fmt.Errorf("unable to remove pending paths: %w", err)
+		}
+	}
+
+	if displaced != nil {
+		r.reduceIndex(displaced.Owner, displaced)
+	}
+
 	r.index(n)
 
-	(*next)[n.FQDN()] = n
+	next[n.FQDN()] = n
 
 	r.exchange(next)
 
-	(*old)[n.FQDN()] = n
+	if displaced != nil {
+		r.emit(NameRemoved, displaced)
+
+		if displaced.Owner != n.Owner {
+			r.notify(displaced.Owner, fmt.Sprintf("%s was claimed by someone else before it was verified", displaced.Name))
+		}
+	}
+
+	for _, p := range displacedPaths {
+		r.emit(NameRemoved, p)
+		r.notify(p.Owner, fmt.Sprintf("%s was claimed by someone else before it was verified", p.FQDN()))
+	}
+
+	r.emit(NameAdded, n)
 
 	return nil
 }
@@ -274,10 +537,10 @@ func (r *Router) AddName(n *NamedRoute) error {
 // * The route is a *NamedRoute
 // * The *NamedRoute's owner, is the one trying to remove it
 func (r *Router) RemoveName(s string, from Routable) error {
-	next, old := r.begin()
+	next := r.begin()
 	defer r.finish()
 
-	toRemove, exists := (*next)[s]
+	toRemove, exists := next[s]
 	if !exists {
 		return fmt.Errorf("%s does not exist", s)
 	}
@@ -288,8 +551,8 @@ func (r *Router) RemoveName(s string, from Routable) error {
 		return fmt.Errorf("%s is not a named route", s)
 	}
 
-	// the Routable must own this namedRoute
-	if namedRouteToRemove.Owner != from.FQDN() {
+	// the Routable, or its account, must own this namedRoute
+	if namedRouteToRemove.Owner != r.ownerOf(from.FQDN()) {
 		return fmt.Errorf("%s is not your route to remove", s)
 	}
 
@@ -299,23 +562,25 @@ func (r *Router) RemoveName(s string, from Routable) error {
 		return fmt.Errorf("fs error: %w", err)
 	}
 
-	r.reduceIndex(from.FQDN(), namedRouteToRemove)
+	r.reduceIndex(namedRouteToRemove.Owner, namedRouteToRemove)
 
-	delete((*next), s)
+	delete(next, s)
 
 	r.exchange(next)
 
-	delete((*old), s)
+	r.emit(NameRemoved, namedRouteToRemove)
 
 	return nil
 }
 
 // RemoveNames removes all names from a Routable
 func (r *Router) RemoveNames(from Routable) ([]*NamedRoute, error) {
-	next, old := r.begin()
+	next := r.begin()
 	defer r.finish()
 
-	list, exists := r.nameIndex[from.FQDN()]
+	owner := r.ownerOf(from.FQDN())
+
+	list, exists := r.nameIndex[owner]
 	if !exists {
 		return make([]*NamedRoute, 0), nil
 	}
@@ -323,35 +588,35 @@ func (r *Router) RemoveNames(from Routable) ([]*NamedRoute, error) {
 	// remove namedroutes until we hit the first error
 	var successes int
 	var err error
-	for i, n := range list {
+	for _, n := range list {
 		err = r.unlink(n.FQDN())
 		if err != nil {
 			break
 		}
 
-		successes = i
+		successes++
 
-		r.reduceIndex(from.FQDN(), n)
+		r.reduceIndex(owner, n)
 
-		delete((*next), n.FQDN())
+		delete(next, n.FQDN())
 	}
 
 	r.exchange(next)
 
-	// remove the same from the old list
-	for i := 0; i <= successes; i++ {
-		delete((*old), list[i].FQDN())
+	for _, n := range list[:successes] {
+		r.emit(NameRemoved, n)
 	}
-	return list[:successes+1], err
+
+	return list[:successes], err
 
 }
 
 // Names returns a list of NamedRoutes
 func (r *Router) Names(rtbl Routable) ([]NamedRoute, error) {
-	r.RLock()
-	defer r.RUnlock()
+	r.editLock.Lock()
+	defer r.editLock.Unlock()
 
-	n, exists := r.nameIndex[rtbl.FQDN()]
+	n, exists := r.nameIndex[r.ownerOf(rtbl.FQDN())]
 	if !exists {
 		return make([]NamedRoute, 0), nil
 	}
@@ -364,28 +629,65 @@ func (r *Router) Names(rtbl Routable) ([]NamedRoute, error) {
 	return names, nil
 }
 
-// Find fetches a route
+// Quota returns how many NamedRoutes and PathRoutes rtbl have, and how many it is allowed - zero meaning unlimited
+func (r *Router) Quota(rtbl Routable) (int, int) {
+	r.editLock.Lock()
+	defer r.editLock.Unlock()
+
+	return r.used(r.ownerOf(rtbl.FQDN())), r.maxNames
+}
+
+// Find fetches a route, or the most specific wildcard route covering it
 func (r *Router) Find(n string) (Routable, bool) {
-	r.RLock()
-	d, exists := (*r.active)[n]
-	r.RUnlock()
+	d, exists := lookup(r.table(), n)
 
 	return d, exists
 }
 
 // Exists returns an error if a given hostname does not exist
 func (r *Router) Exists(_ context.Context, s string) error {
-	r.RLock()
-	_, exists := (*r.active)[s]
-	r.RUnlock()
+	table := r.table()
+	d, exists := lookup(table, s)
 
 	if !exists {
-		return fmt.Errorf("%w: %s not found", ErrNotFound, s)
+		// hostnames made up of path routes only, exists as well - once one of them is verified
+		paths, active := r.hasPaths(s)
+		if !paths {
+			return fmt.Errorf("%w: %s not found", ErrNotFound, s)
+		}
+
+		if !active {
+			return fmt.Errorf("%w: %s", ErrPending, s)
+		}
+
+		return nil
+	}
+
+	if n, ok := d.(*NamedRoute); ok && n.Pending {
+		return fmt.Errorf("%w: %s", ErrPending, s)
 	}
 
 	return nil
 }
 
+// notify passes msg on to every key of owner, that is online and able to receive messages
+func (r *Router) notify(owner, msg string) {
+	table := r.table()
+	for _, key := range r.keysOf(owner) {
+		host, ok := table[key].(*Host)
+		if !ok {
+			continue
+		}
+
+		notifier, ok := host.Routable.(Notifier)
+		if !ok {
+			continue
+		}
+
+		notifier.Notify(msg)
+	}
+}
+
 func (r *Router) index(value *NamedRoute) {
 	_, exists := r.nameIndex[value.Owner]
 	if exists {
@@ -395,7 +697,20 @@ func (r *Router) index(value *NamedRoute) {
 	}
 }
 
+// swapIndex replaces old with new in the index, keeping its position
+func (r *Router) swapIndex(old, new *NamedRoute) {
+	for i, n := range r.nameIndex[old.Owner] {
+		if n == old {
+			r.nameIndex[old.Owner][i] = new
+			return
+		}
+	}
+}
+
 func (r *Router) reduceIndex(key string, value *NamedRoute) {
+	// names leaving the index, are done taking turns
+	r.balancer.forget(value)
+
 	i, exists := r.nameIndex[key]
 	if !exists {
 		return
@@ -427,19 +742,27 @@ func (r *Router) reduceIndex(key string, value *NamedRoute) {
 	r.nameIndex[key] = append(ret, i[idx+1:]...)
 }
 
-func (r *Router) begin() (*map[string]Routable, *map[string]Routable) {
+// table returns the current routing table, which must not be modified
+func (r *Router) table() map[string]Routable {
+	return r.routes.Load().(map[string]Routable)
+}
+
+// begin locks out other editors and returns a copy of the current routing table to be edited
+func (r *Router) begin() map[string]Routable {
 	r.editLock.Lock()
-	if r.active == r.a {
-		return r.b, r.a
+
+	current := r.table()
+	next := make(map[string]Routable, len(current)+1)
+	for k, v := range current {
+		next[k] = v
 	}
 
-	return r.a, r.b
+	return next
 }
 
-func (r *Router) exchange(m *map[string]Routable) {
-	r.Lock()
-	r.active = m
-	r.Unlock()
+// exchange publishes the edited routing table to readers
+func (r *Router) exchange(m map[string]Routable) {
+	r.routes.Store(m)
 }
 
 func (r *Router) finish() {
@@ -447,33 +770,40 @@ func (r *Router) finish() {
 }
 
 func (r *Router) store(n string, i *Intermediate) error {
-	p := path.Join(r.dbPath, fmt.Sprint(n, ".json"))
+	i.Version = r.tick()
 
-	fd, err := os.Create(p)
+	data, err := json.Marshal(i)
+	if err != nil {
+		return fmt.Errorf("unable to encode data: %w", err)
+	}
+
+	err = r.db.Put(n, data)
 	if err != nil {
 		return fmt.Errorf("unable to store data: %w", err)
 	}
 
-	defer fd.Close()
+	r.remember(n, i)
 
-	enc := json.NewEncoder(fd)
-	err = enc.Encode(i)
-	if err != nil {
-		return fmt.Errorf("unable to encode data: %w", err)
+	// changes are passed on to the rest of the cluster
+	if r.cluster != nil {
+		r.cluster.Put(n, data)
 	}
 
 	return nil
 }
 
+// unlink removes the record n. Within a cluster, a tombstone is left behind and passed on in its place
 func (r *Router) unlink(n string) error {
-	p := path.Join(r.dbPath, fmt.Sprint(n, ".json"))
-
-	err := os.Remove(p)
+	if r.cluster != nil {
+		return r.store(n, &Intermediate{Tombstone: &Tombstone{Name: n, Removed: time.Now()}})
+	}
 
-	// If this file did not exist - its okay
-	if errors.Is(err, syscall.ENOENT) {
-		return nil
+	err := r.db.Delete(n)
+	if err != nil {
+		return err
 	}
 
-	return err
+	delete(r.versions, n)
+
+	return nil
 }
@@ -7,13 +7,18 @@ import (
 	"net"
 	"os"
 	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 )
 
 var router *Router
 
+// routerPath is where router keeps its records
+var routerPath string
+
 var errDummy = errors.New("not implemented in DummyRoutable")
 
 func TestRouter(t *testing.T) {
@@ -23,7 +28,8 @@ func TestRouter(t *testing.T) {
 	}
 
 	t.Logf("Opening router with database %s", d)
-	router, err = NewRouter(d)
+	routerPath = d
+	router, err = NewRouter(NewDirStore(d, ""))
 	if err != nil {
 		t.Fatalf("unable to create new router: %s", err)
 	}
@@ -71,7 +77,7 @@ func TestReplace(t *testing.T) {
 }
 
 func TestRestoreDatabase(t *testing.T) {
-	r, err := NewRouter("database_test")
+	r, err := NewRouter(NewDirStore("database_test", ""))
 	if err != nil {
 		t.Fatalf("unable to restore database: %s", err)
 	}
@@ -87,7 +93,7 @@ func TestRestoreDatabase(t *testing.T) {
 	}
 
 	// In this database, there should be a "dummy.remote.moe" host
-	_, exists := (*r.active)["dummy.remote.moe"]
+	_, exists := r.table()["dummy.remote.moe"]
 	if !exists {
 		t.Fatalf("an expected route did not exist")
 	}
@@ -127,6 +133,10 @@ func TestRace(t *testing.T) {
 
 func TestAddRemoveName(t *testing.T) {
 	rtbl := &DummyRoutable{}
+
+	// TestRace may leave the dummy online, depending on which of its routines came last
+	router.Offline(rtbl)
+
 	name := NewName("hejhej.remote.moe", rtbl)
 
 	err := router.AddName(name)
@@ -141,7 +151,7 @@ func TestAddRemoveName(t *testing.T) {
 	}
 
 	// we should also check if the name appeared on our filesystem
-	predictedPath := path.Join(router.dbPath, "hejhej.remote.moe.json")
+	predictedPath := path.Join(routerPath, "hejhej.remote.moe.json")
 
 	_, err = os.Stat(predictedPath)
 	if err != nil {
@@ -259,3 +269,554 @@ func TestNames(t *testing.T) {
 		t.Fatalf("unexpected FQDN of second item: %s", names[0].FQDN())
 	}
 }
+
+type OtherRoutable struct {
+	name string
+}
+
+func (r *OtherRoutable) FQDN() string {
+	return r.name
+}
+
+func (r *OtherRoutable) DialContext(_ context.Context, _, _ string) (net.Conn, error) {
+	return nil, errDummy
+}
+
+func (r *OtherRoutable) Replaced() {}
+
+// newTestRouter returns a router keeping its records in the directory d, e.g. t.TempDir()
+func newTestRouter(tb testing.TB, d string, options ...Option) *Router {
+	tb.Helper()
+
+	r, err := NewRouter(NewDirStore(d, ""), options...)
+	if err != nil {
+		tb.Fatalf("unable to create new router: %s", err)
+	}
+
+	return r
+}
+
+func TestCollect(t *testing.T) {
+	d := t.TempDir()
+	r := newTestRouter(t, d)
+
+	stale := &OtherRoutable{name: "stale.remote.moe"}
+	online := &OtherRoutable{name: "online.remote.moe"}
+
+	r.Online(stale)
+	r.Online(online)
+	r.Offline(stale)
+
+	err := r.AddName(NewName("stalename.remote.moe", stale))
+	if err != nil {
+		t.Fatalf("could not add name: %s", err)
+	}
+
+	err = r.AddName(NewName("onlinename.remote.moe", online))
+	if err != nil {
+		t.Fatalf("could not add name: %s", err)
+	}
+
+	// nothing has been offline for an hour
+	reaped, err := r.Collect(time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected collect error: %s", err)
+	}
+
+	if len(reaped) != 0 {
+		t.Fatalf("expected nothing to be collected, got %d routes", len(reaped))
+	}
+
+	reaped, err = r.Collect(0)
+	if err != nil {
+		t.Fatalf("unexpected collect error: %s", err)
+	}
+
+	if len(reaped) != 2 {
+		t.Fatalf("expected 2 collected routes, got %d", len(reaped))
+	}
+
+	if reaped[0].FQDN() != "stalename.remote.moe" || reaped[1].FQDN() != "stale.remote.moe" {
+		t.Fatalf("unexpected routes collected: %s, %s", reaped[0].FQDN(), reaped[1].FQDN())
+	}
+
+	for _, n := range []string{"stale.remote.moe", "stalename.remote.moe"} {
+		_, exists := r.Find(n)
+		if exists {
+			t.Fatalf("%s was not removed from the router", n)
+		}
+
+		_, err = os.Stat(path.Join(d, n+".json"))
+		if err == nil {
+			t.Fatalf("%s was not removed from fs", n)
+		}
+	}
+
+	if _, exists := r.nameIndex[stale.FQDN()]; exists {
+		t.Fatalf("stale host was not removed from the name index")
+	}
+
+	_, err = r.DialContext(context.TODO(), "tcp", "onlinename.remote.moe:80")
+	if !errors.Is(err, errDummy) {
+		t.Fatalf("expected errDummy, got: %s", err)
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	d := t.TempDir()
+	q := path.Join(d, "quarantine")
+
+	// a truncated record, as left behind by a crash mid-write
+	err := os.WriteFile(path.Join(d, "broken.remote.moe.json"), []byte(`{"host": {"name":"bro`), 0600)
+	if err != nil {
+		t.Fatalf("unable to write broken record: %s", err)
+	}
+
+	// and a temporary file from a write that never finished
+	err = os.WriteFile(path.Join(d, "dummy.remote.moe.json.123.tmp"), []byte(`{"host": {`), 0600)
+	if err != nil {
+		t.Fatalf("unable to write temporary record: %s", err)
+	}
+
+	_, err = NewRouter(NewDirStore(d, q))
+	if err == nil {
+		t.Fatalf("expected broken record to keep the router from starting")
+	}
+
+	r, err := NewRouter(NewDirStore(d, q), WithQuarantine())
+	if err != nil {
+		t.Fatalf("unable to start router with quarantine: %s", err)
+	}
+
+	_, err = os.Stat(path.Join(q, "broken.remote.moe.json"))
+	if err != nil {
+		t.Fatalf("broken record was not quarantined: %s", err)
+	}
+
+	// temporary files could be writes in progress by someone else, they are only removed when cleaning
+	_, err = os.Stat(path.Join(d, "dummy.remote.moe.json.123.tmp"))
+	if err != nil {
+		t.Fatalf("temporary record was touched by starting the router: %s", err)
+	}
+
+	err = NewDirStore(d, q).Clean()
+	if err != nil {
+		t.Fatalf("unable to clean database: %s", err)
+	}
+
+	_, err = os.Stat(path.Join(d, "dummy.remote.moe.json.123.tmp"))
+	if err == nil {
+		t.Fatalf("temporary record was not removed")
+	}
+
+	// the router should still work, and be able to start again with its own records
+	_, err = r.Online(&OtherRoutable{name: "fine.remote.moe"})
+	if err != nil {
+		t.Fatalf("unable to put host online: %s", err)
+	}
+
+	entries, err := os.ReadDir(d)
+	if err != nil {
+		t.Fatalf("unable to read database: %s", err)
+	}
+
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), tmpSuffix) {
+			t.Fatalf("temporary file %s left behind", e.Name())
+		}
+	}
+
+	r, err = NewRouter(NewDirStore(d, q), WithQuarantine())
+	if err != nil {
+		t.Fatalf("unable to restart router: %s", err)
+	}
+
+	_, exists := r.Find("fine.remote.moe")
+	if !exists {
+		t.Fatalf("stored host did not survive a restart")
+	}
+}
+
+// benchmarkChurn keeps putting a host online and offline, as well as adding and
+// removing names, until the returned func is called
+func benchmarkChurn(b *testing.B, r *Router) func() {
+	done := make(chan struct{})
+	var g errgroup.Group
+
+	g.Go(func() error {
+		churn := &OtherRoutable{name: "churn.remote.moe"}
+		for {
+			select {
+			case <-done:
+				return nil
+			default:
+			}
+
+			r.Online(churn)
+			r.AddName(NewName("churning.remote.moe", churn))
+			r.RemoveName("churning.remote.moe", churn)
+			r.Offline(churn)
+		}
+	})
+
+	return func() {
+		close(done)
+		g.Wait()
+	}
+}
+
+func benchmarkRouter(b *testing.B) *Router {
+	r := newTestRouter(b, b.TempDir())
+
+	_, err := r.Online(&DummyRoutable{})
+	if err != nil {
+		b.Fatalf("unable to put dummy online: %s", err)
+	}
+
+	return r
+}
+
+// BenchmarkDialContext dials an online host while the routing table is being edited
+func BenchmarkDialContext(b *testing.B) {
+	r := benchmarkRouter(b)
+	stop := benchmarkChurn(b, r)
+	defer stop()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, err := r.DialContext(context.TODO(), "tcp", "dummy.remote.moe:80")
+			if !errors.Is(err, errDummy) {
+				b.Errorf("expected errDummy, got: %s", err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkExists looks up hosts, as the autocert host policy does, while the routing table is being edited
+func BenchmarkExists(b *testing.B) {
+	r := benchmarkRouter(b)
+	stop := benchmarkChurn(b, r)
+	defer stop()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			err := r.Exists(context.TODO(), "dummy.remote.moe")
+			if err != nil {
+				b.Errorf("expected dummy to exist: %s", err)
+				return
+			}
+		}
+	})
+}
+
+func TestSubscribe(t *testing.T) {
+	r := newTestRouter(t, t.TempDir())
+
+	events, cancel := r.Subscribe()
+
+	host := &OtherRoutable{name: "events.remote.moe"}
+	r.Online(host)
+	r.Online(host)
+	r.AddName(NewName("eventname.remote.moe", host))
+	r.AddName(NewName("eventname2.remote.moe", host))
+	r.RemoveName("eventname.remote.moe", host)
+	r.RemoveNames(host)
+	r.Offline(host)
+
+	expected := []Event{
+		{Type: HostOnline, FQDN: "events.remote.moe"},
+		{Type: HostReplaced, FQDN: "events.remote.moe"},
+		{Type: HostOnline, FQDN: "events.remote.moe"},
+		{Type: NameAdded, FQDN: "eventname.remote.moe", Owner: "events.remote.moe"},
+		{Type: NameAdded, FQDN: "eventname2.remote.moe", Owner: "events.remote.moe"},
+		{Type: NameRemoved, FQDN: "eventname.remote.moe", Owner: "events.remote.moe"},
+		{Type: NameRemoved, FQDN: "eventname2.remote.moe", Owner: "events.remote.moe"},
+		{Type: HostOffline, FQDN: "events.remote.moe"},
+	}
+
+	for _, e := range expected {
+		got := <-events
+		if got.Type != e.Type || got.FQDN != e.FQDN || got.Owner != e.Owner {
+			t.Fatalf("expected event %s, got %s", e, got)
+		}
+	}
+
+	cancel()
+	cancel()
+
+	_, ok := <-events
+	if ok {
+		t.Fatalf("events was not closed after cancel")
+	}
+
+	// the router should not mind that nobody is listening
+	r.Online(host)
+}
+
+type NotifiedRoutable struct {
+	OtherRoutable
+	msgs chan string
+}
+
+func (r *NotifiedRoutable) Notify(msg string) {
+	r.msgs <- msg
+}
+
+func TestNamedRouteReplaced(t *testing.T) {
+	d := t.TempDir()
+	r := newTestRouter(t, d)
+
+	squatter := &NotifiedRoutable{OtherRoutable: OtherRoutable{name: "squatter.remote.moe"}, msgs: make(chan string, 1)}
+	_, err := r.Online(squatter)
+	if err != nil {
+		t.Fatalf("unable to put squatter online: %s", err)
+	}
+
+	// the squatter grabs the hostname of another key
+	err = r.AddName(NewName("victim.remote.moe", squatter))
+	if err != nil {
+		t.Fatalf("unable to add name: %s", err)
+	}
+
+	victim := &OtherRoutable{name: "victim.remote.moe"}
+	replaced, err := r.Online(victim)
+	if err != nil {
+		t.Fatalf("unable to put victim online: %s", err)
+	}
+
+	if replaced {
+		t.Fatalf("a named route should not count as a replaced session")
+	}
+
+	select {
+	case msg := <-squatter.msgs:
+		t.Logf("squatter was notified: %s", msg)
+	case <-time.After(time.Second):
+		t.Fatalf("squatter was not notified")
+	}
+
+	names, _ := r.Names(squatter)
+	if len(names) != 0 {
+		t.Fatalf("squatted name is still indexed: %+v", names)
+	}
+
+	// the victim's host must be what ends up on disk
+	r, err = NewRouter(NewDirStore(d, ""))
+	if err != nil {
+		t.Fatalf("unable to restart router: %s", err)
+	}
+
+	rtbl, _ := r.Find("victim.remote.moe")
+	if _, ok := rtbl.(*Host); !ok {
+		t.Fatalf("expected victim.remote.moe to be a host after restart, got %T", rtbl)
+	}
+}
+
+func TestWildcard(t *testing.T) {
+	r := newTestRouter(t, t.TempDir())
+
+	alice := &OtherRoutable{name: "alice.remote.moe"}
+	bob := &OtherRoutable{name: "bob.remote.moe"}
+	r.Online(alice)
+	r.Online(bob)
+
+	err := r.AddName(NewName("*.example.com", alice))
+	if err != nil {
+		t.Fatalf("unable to add wildcard: %s", err)
+	}
+
+	err = r.AddName(NewName("*.b.example.com", alice))
+	if err != nil {
+		t.Fatalf("unable to add nested wildcard: %s", err)
+	}
+
+	// the exact name falls back to the wildcard
+	rtbl, exists := r.Find("a.example.com")
+	if !exists || rtbl.FQDN() != "*.example.com" {
+		t.Fatalf("expected a.example.com to be routed by *.example.com, got %v", rtbl)
+	}
+
+	// the most specific wildcard wins
+	rtbl, exists = r.Find("x.a.b.example.com")
+	if !exists || rtbl.FQDN() != "*.b.example.com" {
+		t.Fatalf("expected x.a.b.example.com to be routed by *.b.example.com, got %v", rtbl)
+	}
+
+	// the wildcard does not cover the domain it self
+	err = r.Exists(context.TODO(), "example.com")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected example.com to not exist: %s", err)
+	}
+
+	_, err = r.DialContext(context.TODO(), "tcp", "deep.down.example.com:80")
+	if !errors.Is(err, errDummy) {
+		t.Fatalf("expected wildcard to dial alice, got: %s", err)
+	}
+
+	// bob may not take names inside alice's wildcard
+	err = r.AddName(NewName("bobs.example.com", bob))
+	if err == nil {
+		t.Fatalf("bob was able to add a name covered by alice's wildcard")
+	}
+
+	// and alice may not cover bob's names
+	err = r.AddName(NewName("www.bob.org", bob))
+	if err != nil {
+		t.Fatalf("unable to add name: %s", err)
+	}
+
+	err = r.AddName(NewName("*.bob.org", alice))
+	if err == nil {
+		t.Fatalf("alice was able to add a wildcard covering bob's name")
+	}
+
+	// nor anyone's pubkey hostname
+	err = r.AddName(NewName("*.remote.moe", alice))
+	if err == nil {
+		t.Fatalf("alice was able to add a wildcard covering bob's host")
+	}
+
+	// alice can still add names inside her own wildcard
+	err = r.AddName(NewName("exact.example.com", alice))
+	if err != nil {
+		t.Fatalf("alice was unable to add a name covered by her own wildcard: %s", err)
+	}
+
+	rtbl, _ = r.Find("exact.example.com")
+	if rtbl.FQDN() != "exact.example.com" {
+		t.Fatalf("expected exact name to win over wildcard, got %s", rtbl.FQDN())
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	valid := []string{
+		"hello.remote.moe",
+		"*.hello.remote.moe",
+		"a-b.example.com",
+		"123.example.com",
+		strings.Repeat("a", 63) + ".com",
+	}
+
+	for _, n := range valid {
+		err := ValidateName(n)
+		if err != nil {
+			t.Fatalf("expected %s to be valid: %s", n, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"localhost",
+		"../../etc/passwd",
+		"hello/world.remote.moe",
+		"hello..remote.moe",
+		".remote.moe",
+		"remote.moe.",
+		"-hello.remote.moe",
+		"hello-.remote.moe",
+		"hello_world.remote.moe",
+		"hello.*.remote.moe",
+		"*",
+		strings.Repeat("a", 64) + ".com",
+		strings.Repeat("a.", 127) + "com",
+	}
+
+	for _, n := range invalid {
+		err := ValidateName(n)
+		if !errors.Is(err, ErrInvalidName) {
+			t.Fatalf("expected %q to be invalid, got: %s", n, err)
+		}
+	}
+}
+
+func TestReserved(t *testing.T) {
+	r := newTestRouter(t, t.TempDir(), WithReserved("remote.moe", "*.internal.example.com", "WWW.example.com"))
+
+	rtbl := &OtherRoutable{name: "someone.remote.moe"}
+
+	reserved := []string{
+		"remote.moe",
+		"*.remote.moe",
+		"*.moe",
+		"www.example.com",
+		"*.example.com",
+		"secret.internal.example.com",
+		"*.internal.example.com",
+	}
+
+	for _, n := range reserved {
+		err := r.AddName(NewName(n, rtbl))
+		if !errors.Is(err, ErrReservedName) {
+			t.Fatalf("expected %s to be reserved, got: %s", n, err)
+		}
+	}
+
+	available := []string{
+		"hello.remote.moe",
+		"*.hello.remote.moe",
+		"example.com",
+		"internal.example.com",
+	}
+
+	for _, n := range available {
+		err := r.AddName(NewName(n, rtbl))
+		if err != nil {
+			t.Fatalf("expected %s to be available, got: %s", n, err)
+		}
+	}
+
+	// invalid names must never reach the filesystem
+	err := r.AddName(NewName("../escape.json", rtbl))
+	if !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("expected invalid name error, got: %s", err)
+	}
+}
+
+func TestMaxNames(t *testing.T) {
+	r := newTestRouter(t, t.TempDir(), WithMaxNames(2))
+
+	rtbl := &OtherRoutable{name: "quota.remote.moe"}
+
+	for _, n := range []string{"one.remote.moe", "two.remote.moe"} {
+		err := r.AddName(NewName(n, rtbl))
+		if err != nil {
+			t.Fatalf("unable to add %s: %s", n, err)
+		}
+	}
+
+	// adding an existing name again is not counted
+	err := r.AddName(NewName("two.remote.moe", rtbl))
+	if err != nil {
+		t.Fatalf("unable to re-add name: %s", err)
+	}
+
+	err = r.AddName(NewName("three.remote.moe", rtbl))
+	if !errors.Is(err, ErrQuota) {
+		t.Fatalf("expected quota error, got: %s", err)
+	}
+
+	used, limit := r.Quota(rtbl)
+	if used != 2 || limit != 2 {
+		t.Fatalf("expected quota 2 of 2, got %d of %d", used, limit)
+	}
+
+	// other owners have their own quota
+	err = r.AddName(NewName("three.remote.moe", &OtherRoutable{name: "other.remote.moe"}))
+	if err != nil {
+		t.Fatalf("unable to add name for other owner: %s", err)
+	}
+
+	// removing a name frees up quota
+	err = r.RemoveName("one.remote.moe", rtbl)
+	if err != nil {
+		t.Fatalf("unable to remove name: %s", err)
+	}
+
+	err = r.AddName(NewName("four.remote.moe", rtbl))
+	if err != nil {
+		t.Fatalf("unable to add name after removing one: %s", err)
+	}
+}
@@ -0,0 +1,335 @@
+package routertwo
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Export writes every record of the router to w as a stream of json encoded Intermediates, one per line.
+// Editors of this router are held back while exporting, so the export is a consistent snapshot of the router.
+// Tombstones are left out, they are only of use to the other nodes of a cluster
+func (r *Router) Export(w io.Writer) error {
+	enc := json.NewEncoder(w)
+
+	return r.Snapshot(func(i *Intermediate) error {
+		if i.Tombstone != nil {
+			return nil
+		}
+
+		err := enc.Encode(i)
+		if err != nil {
+			return fmt.Errorf("unable to export %s: %w", i.key(), err)
+		}
+
+		return nil
+	})
+}
+
+// Snapshot calls fn with every record of the router and their versions, accounts and hosts first and
+// tombstones last. Editors are held back until Snapshot returns, fn must not edit the router and must not
+// change the records
+func (r *Router) Snapshot(fn func(*Intermediate) error) error {
+	r.editLock.Lock()
+	defer r.editLock.Unlock()
+
+	records := make([]*Intermediate, 0)
+
+	r.accountsLock.RLock()
+	for _, a := range r.accounts {
+		records = append(records, &Intermediate{Account: a})
+	}
+	r.accountsLock.RUnlock()
+
+	for _, rtbl := range r.table() {
+		switch route := rtbl.(type) {
+		case *Host:
+			records = append(records, &Intermediate{Host: route})
+		case *NamedRoute:
+			records = append(records, &Intermediate{NamedRoute: route})
+		case *PathRoute:
+			records = append(records, &Intermediate{PathRoute: route})
+		}
+	}
+
+	for _, t := range r.tombstones {
+		records = append(records, &Intermediate{Tombstone: t})
+	}
+
+	for _, i := range records {
+		v := r.versions[i.name()]
+		i.Version = &v
+	}
+
+	// accounts and hosts before the names belonging to them, makes exports easier on the eyes
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].kind() != records[j].kind() {
+			return records[i].kind() < records[j].kind()
+		}
+
+		return records[i].key() < records[j].key()
+	})
+
+	for _, i := range records {
+		err := fn(i)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Import reads an export from rd and merges it into the router. The whole export is validated before
+// anything is imported. Records conflicting with existing records, e.g. names owned by someone else,
+// are skipped and returned - existing hosts and accounts are always kept as they are
+func (r *Router) Import(rd io.Reader) (int, []string, error) {
+	records := make([]*Intermediate, 0)
+
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var i Intermediate
+		dec := json.NewDecoder(strings.NewReader(scanner.Text()))
+		dec.DisallowUnknownFields()
+
+		err := dec.Decode(&i)
+		if err != nil {
+			return 0, nil, fmt.Errorf("line %d: unable to decode json: %w", line, err)
+		}
+
+		err = i.validate()
+		if err != nil {
+			return 0, nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		records = append(records, &i)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, nil, fmt.Errorf("unable to read export: %w", err)
+	}
+
+	next := r.begin()
+	defer r.finish()
+
+	imported := 0
+	skipped := make([]string, 0)
+
+	var err error
+	for _, i := range records {
+		var ok bool
+		ok, err = r.merge(next, i)
+		if err != nil {
+			break
+		}
+
+		if !ok {
+			skipped = append(skipped, i.key())
+			continue
+		}
+
+		imported++
+	}
+
+	r.exchange(next)
+
+	if err != nil {
+		return imported, skipped, fmt.Errorf("import stopped after %d records: %w", imported, err)
+	}
+
+	return imported, skipped, nil
+}
+
+// merge stores i and adds it to next, unless it conflicts with existing records
+func (r *Router) merge(next map[string]Routable, i *Intermediate) (bool, error) {
+	switch {
+	case i.Tombstone != nil:
+		return false, nil
+
+	case i.Account != nil:
+		if r.isAccount(i.Account.ID) {
+			return false, nil
+		}
+
+		for _, key := range i.Account.Keys {
+			if r.ownerOf(key) != key {
+				return false, nil
+			}
+		}
+
+		err := r.store(i.Account.ID, i)
+		if err != nil {
+			return false, err
+		}
+
+		r.setAccount(i.Account)
+
+	case i.Host != nil:
+		if _, exists := next[i.Host.Name]; exists {
+			return false, nil
+		}
+
+		// imported hosts are not online anywhere
+		i.Host.Node = ""
+
+		err := r.store(i.Host.Name, i)
+		if err != nil {
+			return false, err
+		}
+
+		next[i.Host.Name] = i.Host
+
+	case i.NamedRoute != nil:
+		n := i.NamedRoute
+
+		existing, exists := next[n.Name]
+		if exists && r.owner(existing) != n.Owner {
+			return false, nil
+		}
+
+		if exists {
+			if _, ok := existing.(*NamedRoute); !ok {
+				return false, nil
+			}
+		}
+
+		err := r.store(n.Name, i)
+		if err != nil {
+			return false, err
+		}
+
+		n.router = r
+
+		if exists {
+			r.swapIndex(existing.(*NamedRoute), n)
+		} else {
+			r.index(n)
+		}
+
+		next[n.Name] = n
+
+	case i.PathRoute != nil:
+		p := i.PathRoute
+
+		if existing, exists := next[p.FQDN()]; exists && r.owner(existing) != p.Owner {
+			return false, nil
+		}
+
+		err := r.store(p.record(), i)
+		if err != nil {
+			return false, err
+		}
+
+		p.router = r
+		r.putPath(next, p)
+	}
+
+	return true, nil
+}
+
+// kind orders records by type
+func (i *Intermediate) kind() int {
+	switch {
+	case i.Account != nil:
+		return 0
+	case i.Host != nil:
+		return 1
+	case i.NamedRoute != nil:
+		return 2
+	case i.PathRoute != nil:
+		return 3
+	}
+
+	return 4
+}
+
+// key returns the name of the record
+func (i *Intermediate) key() string {
+	switch {
+	case i.Account != nil:
+		return i.Account.ID
+	case i.Host != nil:
+		return i.Host.Name
+	case i.NamedRoute != nil:
+		return i.NamedRoute.Name
+	case i.PathRoute != nil:
+		return i.PathRoute.FQDN()
+	case i.Tombstone != nil:
+		return i.Tombstone.Name
+	}
+
+	return ""
+}
+
+// name returns the name the record is stored by
+func (i *Intermediate) name() string {
+	if i.PathRoute != nil {
+		return i.PathRoute.record()
+	}
+
+	return i.key()
+}
+
+// validate makes sure the record is sane, before it is imported
+func (i *Intermediate) validate() error {
+	set := 0
+	for _, isSet := range []bool{i.Account != nil, i.Host != nil, i.NamedRoute != nil, i.PathRoute != nil, i.Tombstone != nil} {
+		if isSet {
+			set++
+		}
+	}
+
+	if set != 1 {
+		return fmt.Errorf("expected exactly one record, found %d", set)
+	}
+
+	switch {
+	case i.Account != nil:
+		if !strings.HasPrefix(i.Account.ID, accountPrefix) || len(i.Account.Keys) == 0 {
+			return fmt.Errorf("invalid account %q", i.Account.ID)
+		}
+
+		for _, key := range i.Account.Keys {
+			if err := ValidateName(key); err != nil {
+				return err
+			}
+		}
+
+	case i.Host != nil:
+		return ValidateName(i.Host.Name)
+
+	case i.NamedRoute != nil:
+		if i.NamedRoute.Owner == "" {
+			return fmt.Errorf("%s does not have an owner", i.NamedRoute.Name)
+		}
+
+		return ValidateName(i.NamedRoute.Name)
+
+	case i.PathRoute != nil:
+		if i.PathRoute.Owner == "" || i.PathRoute.Target == "" {
+			return fmt.Errorf("%s does not have an owner", i.PathRoute.FQDN())
+		}
+
+		if !strings.HasPrefix(i.PathRoute.Prefix, "/") {
+			return fmt.Errorf("%s does not have a valid path", i.PathRoute.FQDN())
+		}
+
+		return ValidateName(i.PathRoute.Name)
+
+	case i.Tombstone != nil:
+		if i.Tombstone.Name == "" {
+			return fmt.Errorf("tombstone without a name")
+		}
+	}
+
+	return nil
+}
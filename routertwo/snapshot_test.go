@@ -0,0 +1,95 @@
+package routertwo
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	src := newTestRouter(t, t.TempDir())
+
+	a := &OtherRoutable{name: "a.remote.moe"}
+	b := &OtherRoutable{name: "b.remote.moe"}
+	src.Online(a)
+	src.Online(b)
+
+	src.Link(a, b.FQDN())
+	src.Link(b, a.FQDN())
+
+	for _, name := range []string{"one.remote.moe", "*.two.remote.moe"} {
+		err := src.AddName(NewName(name, a))
+		if err != nil {
+			t.Fatalf("unable to add name: %s", err)
+		}
+	}
+
+	p, _ := NewPath("site.remote.moe/api", b)
+	err := src.AddPath(p)
+	if err != nil {
+		t.Fatalf("unable to add path: %s", err)
+	}
+
+	var export bytes.Buffer
+	err = src.Export(&export)
+	if err != nil {
+		t.Fatalf("unable to export: %s", err)
+	}
+
+	// one account, two hosts, two names and a path
+	if lines := strings.Count(export.String(), "\n"); lines != 6 {
+		t.Fatalf("expected 6 records, got %d:\n%s", lines, export.String())
+	}
+
+	dst := newTestRouter(t, t.TempDir())
+
+	// someone already has one of the names
+	other := &OtherRoutable{name: "other.remote.moe"}
+	err = dst.AddName(NewName("one.remote.moe", other))
+	if err != nil {
+		t.Fatalf("unable to add name: %s", err)
+	}
+
+	imported, skipped, err := dst.Import(bytes.NewReader(export.Bytes()))
+	if err != nil {
+		t.Fatalf("unable to import: %s", err)
+	}
+
+	if imported != 5 || len(skipped) != 1 || skipped[0] != "one.remote.moe" {
+		t.Fatalf("unexpected import result: %d %+v", imported, skipped)
+	}
+
+	if len(dst.Keys(b)) != 2 {
+		t.Fatalf("account was not imported: %+v", dst.Keys(b))
+	}
+
+	names, _ := dst.Names(b)
+	if len(names) != 1 || names[0].FQDN() != "*.two.remote.moe" {
+		t.Fatalf("unexpected names after import: %+v", names)
+	}
+
+	target, _ := dst.Route("site.remote.moe", "/api/v1")
+	if target != b.FQDN() {
+		t.Fatalf("path was not imported, got %s", target)
+	}
+
+	// importing again changes nothing
+	_, skipped, err = dst.Import(bytes.NewReader(export.Bytes()))
+	if err != nil || len(skipped) != 4 {
+		t.Fatalf("expected existing account and hosts, and the conflicting name to be skipped: %+v %s", skipped, err)
+	}
+
+	// broken exports are rejected as a whole
+	broken := export.String() + `{"namedroute":{"Name":"not a name","Owner":"a.remote.moe"}}` + "\n"
+
+	fresh := newTestRouter(t, t.TempDir())
+	imported, _, err = fresh.Import(strings.NewReader(broken))
+	if err == nil || imported != 0 {
+		t.Fatalf("expected broken export to be rejected: %d %s", imported, err)
+	}
+
+	_, exists := fresh.Find("a.remote.moe")
+	if exists {
+		t.Fatalf("records of a broken export was imported")
+	}
+}
@@ -0,0 +1,86 @@
+package routertwo
+
+import (
+	"time"
+)
+
+// OnlineStandby is like Online, but if another session with the same key is online, rtbl is kept on standby
+// instead of replacing it. Sessions on standby takes over, in the order they arrived, as the current session
+// goes offline. OnlineStandby returns true if rtbl was put on standby
+func (r *Router) OnlineStandby(rtbl Routable) (bool, error) {
+	next := r.begin()
+	defer r.finish()
+
+	host, ok := next[rtbl.FQDN()].(*Host)
+	if !ok || host.Routable == nil {
+		_, err := r.online(next, rtbl)
+		return false, err
+	}
+
+	standby := make([]Routable, 0, len(host.Standby)+1)
+	standby = append(standby, host.Standby...)
+	standby = append(standby, rtbl)
+
+	// readers may be using the current host, so a new host replaces it
+	next[host.Name] = &Host{
+		Routable: host.Routable,
+		Name:     host.Name,
+		Standby:  standby,
+		Node:     host.Node,
+		LastSeen: host.LastSeen,
+		Created:  host.Created,
+	}
+
+	r.exchange(next)
+
+	return true, nil
+}
+
+// offlineStandby removes rtbl from the sessions on standby of host, and reports whether rtbl was found
+func (r *Router) offlineStandby(next map[string]Routable, host *Host, rtbl Routable) bool {
+	standby := make([]Routable, 0, len(host.Standby))
+	for _, s := range host.Standby {
+		if s != rtbl {
+			standby = append(standby, s)
+		}
+	}
+
+	if len(standby) == len(host.Standby) {
+		return false
+	}
+
+	next[host.Name] = &Host{
+		Routable: host.Routable,
+		Name:     host.Name,
+		Standby:  standby,
+		Node:     host.Node,
+		LastSeen: host.LastSeen,
+		Created:  host.Created,
+	}
+
+	r.exchange(next)
+
+	return true
+}
+
+// promote lets the first session on standby take over host
+func (r *Router) promote(next map[string]Routable, host *Host) {
+	host = &Host{
+		Routable: host.Standby[0],
+		Name:     host.Name,
+		Standby:  host.Standby[1:],
+		Node:     host.Node,
+		LastSeen: time.Now(),
+		Created:  host.Created,
+	}
+
+	next[host.Name] = host
+
+	r.exchange(next)
+
+	r.emit(HostOnline, host)
+
+	if notifier, ok := host.Routable.(Notifier); ok {
+		notifier.Notify("the previous session went away, this session is now active")
+	}
+}
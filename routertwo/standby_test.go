@@ -0,0 +1,69 @@
+package routertwo
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStandby(t *testing.T) {
+	r := newTestRouter(t, t.TempDir())
+
+	primary := &PooledRoutable{OtherRoutable: OtherRoutable{name: "pi.remote.moe"}}
+	spare := &PooledRoutable{OtherRoutable: OtherRoutable{name: "pi.remote.moe"}}
+	last := &PooledRoutable{OtherRoutable: OtherRoutable{name: "pi.remote.moe"}}
+
+	// without anyone to wait for, sessions go online right away
+	standby, err := r.OnlineStandby(primary)
+	if err != nil || standby {
+		t.Fatalf("expected first session to go online: %t %s", standby, err)
+	}
+
+	standby, err = r.OnlineStandby(spare)
+	if err != nil || !standby {
+		t.Fatalf("expected second session to be on standby: %t %s", standby, err)
+	}
+
+	r.OnlineStandby(last)
+
+	dial := func() {
+		c, err := r.DialContext(context.TODO(), "tcp", "pi.remote.moe:80")
+		if err != nil {
+			t.Fatalf("unable to dial: %s", err)
+		}
+
+		c.Close()
+	}
+
+	dial()
+	if primary.dials != 1 || spare.dials != 0 || primary.replaced != 0 {
+		t.Fatalf("expected primary to be in use and untouched")
+	}
+
+	// sessions on standby may leave without anyone noticing
+	r.Offline(last)
+
+	r.Offline(primary)
+	dial()
+
+	if spare.dials != 1 {
+		t.Fatalf("expected spare to be promoted")
+	}
+
+	r.Offline(spare)
+
+	_, err = r.DialContext(context.TODO(), "tcp", "pi.remote.moe:80")
+	if err == nil || last.dials != 0 {
+		t.Fatalf("expected host to be offline, got: %s", err)
+	}
+
+	// sessions on standby survives replacements of the current session
+	r.OnlineStandby(primary)
+	r.OnlineStandby(spare)
+	r.Online(last)
+	r.Offline(last)
+	dial()
+
+	if spare.dials != 2 {
+		t.Fatalf("expected spare to be promoted after replacement")
+	}
+}
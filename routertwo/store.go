@@ -0,0 +1,208 @@
+package routertwo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Store persists router records, keyed by their FQDN
+type Store interface {
+	// Walk calls fn with every record in the store
+	Walk(fn func(name string, data []byte) error) error
+
+	// Put creates or replaces a record
+	Put(name string, data []byte) error
+
+	// Delete removes a record, it is not an error if the record did not exist
+	Delete(name string) error
+
+	// Quarantine moves a record out of the way, such that it is not walked again
+	Quarantine(name string) error
+
+	Close() error
+}
+
+// Copy copies every record in src into dst and returns the number of records copied
+func Copy(dst, src Store) (int, error) {
+	var n int
+	err := src.Walk(func(name string, data []byte) error {
+		err := dst.Put(name, data)
+		if err != nil {
+			return fmt.Errorf("unable to copy %s: %w", name, err)
+		}
+
+		n++
+		return nil
+	})
+
+	return n, err
+}
+
+// tmpSuffix is used for records that are in the process of being written
+const tmpSuffix = ".tmp"
+
+// DirStore stores each record as a json file in a directory
+type DirStore struct {
+	// Path is the directory holding the records
+	Path string
+
+	// QuarantinePath is where records are moved when quarantined
+	QuarantinePath string
+}
+
+// NewDirStore returns a DirStore using the directory dir, and quarantining records into quarantine
+func NewDirStore(dir, quarantine string) *DirStore {
+	return &DirStore{Path: dir, QuarantinePath: quarantine}
+}
+
+// Walk calls fn for each record file in the directory
+func (d *DirStore) Walk(fn func(name string, data []byte) error) error {
+	return filepath.WalkDir(d.Path, func(p string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if e.IsDir() {
+			// the quarantine could very well live inside the database
+			if d.QuarantinePath != "" && filepath.Clean(p) == filepath.Clean(d.QuarantinePath) {
+				return fs.SkipDir
+			}
+
+			return nil
+		}
+
+		// writes in progress, or leftovers from writes that never made it - see Clean
+		if strings.HasSuffix(p, tmpSuffix) {
+			return nil
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %w", p, err)
+		}
+
+		return fn(strings.TrimSuffix(filepath.Base(p), ".json"), data)
+	})
+}
+
+// Clean removes leftovers from writes that never made it - the original records, if any, are still intact.
+// Clean must only be called while no one is writing to the directory, i.e. when remotemoe starts
+func (d *DirStore) Clean() error {
+	entries, err := os.ReadDir(d.Path)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %w", d.Path, err)
+	}
+
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), tmpSuffix) {
+			continue
+		}
+
+		p := filepath.Join(d.Path, e.Name())
+		log.Printf("router: removing incomplete write %s", p)
+
+		err = os.Remove(p)
+		if err != nil {
+			return fmt.Errorf("unable to remove %s: %w", p, err)
+		}
+	}
+
+	return nil
+}
+
+// Put writes the record to a temporary file, which is synced and then renamed into place
+// - a crash or full disk mid-write will leave the previous record, if any, untouched
+func (d *DirStore) Put(name string, data []byte) error {
+	fd, err := os.CreateTemp(d.Path, fmt.Sprint(name, ".json.*", tmpSuffix))
+	if err != nil {
+		return fmt.Errorf("unable to store data: %w", err)
+	}
+
+	// if anything goes wrong, the temporary file should not be left behind
+	defer func() {
+		if err != nil {
+			fd.Close()
+			os.Remove(fd.Name())
+		}
+	}()
+
+	_, err = fd.Write(data)
+	if err != nil {
+		return fmt.Errorf("unable to write data: %w", err)
+	}
+
+	err = fd.Sync()
+	if err != nil {
+		return fmt.Errorf("unable to sync data: %w", err)
+	}
+
+	err = fd.Close()
+	if err != nil {
+		return fmt.Errorf("unable to close data: %w", err)
+	}
+
+	err = os.Rename(fd.Name(), d.path(name))
+	if err != nil {
+		return fmt.Errorf("unable to move data into place: %w", err)
+	}
+
+	// the rename itself is only durable once the directory is synced
+	dir, err := os.Open(d.Path)
+	if err != nil {
+		return fmt.Errorf("unable to open database directory: %w", err)
+	}
+	defer dir.Close()
+
+	err = dir.Sync()
+	if err != nil {
+		return fmt.Errorf("unable to sync database directory: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes the record file
+func (d *DirStore) Delete(name string) error {
+	err := os.Remove(d.path(name))
+
+	// If this file did not exist - its okay
+	if errors.Is(err, syscall.ENOENT) {
+		return nil
+	}
+
+	return err
+}
+
+// Quarantine moves the record file into QuarantinePath
+func (d *DirStore) Quarantine(name string) error {
+	if d.QuarantinePath == "" {
+		return fmt.Errorf("no quarantine directory configured")
+	}
+
+	err := os.MkdirAll(d.QuarantinePath, 0700)
+	if err != nil {
+		return fmt.Errorf("unable to make quarantine directory: %w", err)
+	}
+
+	err = os.Rename(d.path(name), filepath.Join(d.QuarantinePath, fmt.Sprint(name, ".json")))
+	if err != nil {
+		return fmt.Errorf("unable to quarantine %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// Close does nothing for directories
+func (d *DirStore) Close() error {
+	return nil
+}
+
+func (d *DirStore) path(name string) string {
+	return filepath.Join(d.Path, fmt.Sprint(name, ".json"))
+}
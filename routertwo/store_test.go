@@ -0,0 +1,115 @@
+package routertwo
+
+import (
+	"path"
+	"testing"
+)
+
+func testStore(t *testing.T, s Store) {
+	err := s.Put("a.remote.moe", []byte(`{"host": {"name":"a.remote.moe"}}`))
+	if err != nil {
+		t.Fatalf("unable to put record: %s", err)
+	}
+
+	err = s.Put("b.remote.moe", []byte(`{"host": {"name":"b.remote.moe"}}`))
+	if err != nil {
+		t.Fatalf("unable to put record: %s", err)
+	}
+
+	// replacing a record should not leave the old one behind
+	err = s.Put("b.remote.moe", []byte(`{"host": {"name":"b.remote.moe","created":"2021-04-19T21:37:05Z"}}`))
+	if err != nil {
+		t.Fatalf("unable to replace record: %s", err)
+	}
+
+	records := walk(t, s)
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d: %+v", len(records), records)
+	}
+
+	if records["b.remote.moe"] != `{"host": {"name":"b.remote.moe","created":"2021-04-19T21:37:05Z"}}` {
+		t.Fatalf("b.remote.moe was not replaced: %s", records["b.remote.moe"])
+	}
+
+	err = s.Delete("a.remote.moe")
+	if err != nil {
+		t.Fatalf("unable to delete record: %s", err)
+	}
+
+	// deleting something that does not exist is fine
+	err = s.Delete("a.remote.moe")
+	if err != nil {
+		t.Fatalf("unable to delete missing record: %s", err)
+	}
+
+	err = s.Quarantine("b.remote.moe")
+	if err != nil {
+		t.Fatalf("unable to quarantine record: %s", err)
+	}
+
+	records = walk(t, s)
+	if len(records) != 0 {
+		t.Fatalf("expected no records, got %+v", records)
+	}
+}
+
+func walk(t *testing.T, s Store) map[string]string {
+	records := make(map[string]string)
+	err := s.Walk(func(name string, data []byte) error {
+		records[name] = string(data)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("unable to walk store: %s", err)
+	}
+
+	return records
+}
+
+func TestDirStore(t *testing.T) {
+	d := t.TempDir()
+
+	testStore(t, NewDirStore(d, path.Join(d, "quarantine")))
+}
+
+func TestBoltStore(t *testing.T) {
+	d := t.TempDir()
+
+	s, err := NewBoltStore(path.Join(d, "routerdata.db"))
+	if err != nil {
+		t.Fatalf("unable to open bolt store: %s", err)
+	}
+	defer s.Close()
+
+	testStore(t, s)
+}
+
+func TestCopy(t *testing.T) {
+	d := t.TempDir()
+
+	dst, err := NewBoltStore(path.Join(d, "routerdata.db"))
+	if err != nil {
+		t.Fatalf("unable to open bolt store: %s", err)
+	}
+
+	n, err := Copy(dst, NewDirStore("database_test", ""))
+	if err != nil {
+		t.Fatalf("unable to copy: %s", err)
+	}
+
+	if n != 1 {
+		t.Fatalf("expected 1 record to be copied, got %d", n)
+	}
+
+	r, err := NewRouter(dst)
+	if err != nil {
+		t.Fatalf("unable to start router from copy: %s", err)
+	}
+	defer r.Close()
+
+	_, exists := r.Find("dummy.remote.moe")
+	if !exists {
+		t.Fatalf("copied host does not exist")
+	}
+}
@@ -0,0 +1,115 @@
+package routertwo
+
+import (
+	"fmt"
+	"sort"
+)
+
+// transfer is a pending offer of a name, from its owner to another key
+type transfer struct {
+	// from is the owner of the name when the offer was made
+	from string
+
+	// to is the key which must accept the offer
+	to string
+}
+
+// Transfer offers the name s, owned by from, to the key to. The name stays with its owner until to accepts
+// the offer using Accept - offers are kept in memory and does not survive restarts
+func (r *Router) Transfer(from Routable, s, to string) error {
+	next := r.begin()
+	defer r.finish()
+
+	n, ok := next[s].(*NamedRoute)
+	if !ok {
+		return fmt.Errorf("%s is not a named route", s)
+	}
+
+	owner := r.ownerOf(from.FQDN())
+	if n.Owner != owner {
+		return fmt.Errorf("%s is not your route to transfer", s)
+	}
+
+	if r.ownerOf(to) == owner {
+		return fmt.Errorf("%s already owns %s", to, s)
+	}
+
+	// a new offer replaces any previous offer of the name
+	r.transfers[s] = transfer{from: owner, to: to}
+
+	r.notify(to, fmt.Sprintf("%s offers you %s, run \"host accept %s\" to accept it", from.FQDN(), s, s))
+
+	return nil
+}
+
+// Accept accepts a transfer of the name s, offered to by. The name is handed over in one go,
+// it is never without an owner that someone else could grab it from
+func (r *Router) Accept(by Routable, s string) error {
+	next := r.begin()
+	defer r.finish()
+
+	offer, exists := r.transfers[s]
+	if !exists || offer.to != by.FQDN() {
+		return fmt.Errorf("%s have not been offered to you", s)
+	}
+
+	// the name may have been removed, or changed hands, since the offer was made
+	n, ok := next[s].(*NamedRoute)
+	if !ok || n.Owner != offer.from {
+		delete(r.transfers, s)
+		return fmt.Errorf("%s is no longer available", s)
+	}
+
+	owner := r.ownerOf(by.FQDN())
+
+	if r.maxNames > 0 && r.used(owner) >= r.maxNames {
+		return fmt.Errorf("%w: you already have %d hostnames", ErrQuota, r.maxNames)
+	}
+
+	candidate := *n
+	candidate.Owner = owner
+	candidate.Target = by.FQDN()
+
+	if rtbl, shadows := r.shadowed(next, &candidate); shadows {
+		if IsWildcard(s) {
+			return fmt.Errorf("%s covers %s which belongs to someone else", s, rtbl.FQDN())
+		}
+
+		return fmt.Errorf("%s is covered by %s which belongs to someone else", s, rtbl.FQDN())
+	}
+
+	err := r.replaceName(next, n, func(accepted *NamedRoute) {
+		accepted.Owner = candidate.Owner
+		accepted.Target = candidate.Target
+	})
+
+	if err != nil {
+		return err
+	}
+
+	delete(r.transfers, s)
+
+	r.exchange(next)
+
+	r.emit(NameTransferred, next[s])
+	r.notify(offer.from, fmt.Sprintf("%s was transferred to %s", s, by.FQDN()))
+
+	return nil
+}
+
+// Offers returns names offered to rtbl
+func (r *Router) Offers(rtbl Routable) []string {
+	r.editLock.Lock()
+	defer r.editLock.Unlock()
+
+	offers := make([]string, 0)
+	for name, offer := range r.transfers {
+		if offer.to == rtbl.FQDN() {
+			offers = append(offers, name)
+		}
+	}
+
+	sort.Strings(offers)
+
+	return offers
+}
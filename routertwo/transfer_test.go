@@ -0,0 +1,117 @@
+package routertwo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTransfer(t *testing.T) {
+	d := t.TempDir()
+	r := newTestRouter(t, d)
+
+	events, cancel := r.Subscribe()
+	defer cancel()
+
+	old := &OtherRoutable{name: "oldkey.remote.moe"}
+	rotated := &NotifiedRoutable{OtherRoutable: OtherRoutable{name: "newkey.remote.moe"}, msgs: make(chan string, 1)}
+	someone := &OtherRoutable{name: "someone.remote.moe"}
+	r.Online(old)
+	r.Online(rotated)
+
+	err := r.AddName(NewName("ci.remote.moe", old))
+	if err != nil {
+		t.Fatalf("unable to add name: %s", err)
+	}
+
+	err = r.Transfer(someone, "ci.remote.moe", rotated.FQDN())
+	if err == nil {
+		t.Fatalf("someone was able to transfer a name they do not own")
+	}
+
+	err = r.Transfer(old, "ci.remote.moe", rotated.FQDN())
+	if err != nil {
+		t.Fatalf("unable to transfer: %s", err)
+	}
+
+	select {
+	case <-rotated.msgs:
+	case <-time.After(time.Second):
+		t.Fatalf("receiver was not notified about the offer")
+	}
+
+	// the name stays with its owner until accepted
+	names, _ := r.Names(old)
+	if len(names) != 1 {
+		t.Fatalf("name left its owner before being accepted: %+v", names)
+	}
+
+	offers := r.Offers(rotated)
+	if len(offers) != 1 || offers[0] != "ci.remote.moe" {
+		t.Fatalf("unexpected offers: %+v", offers)
+	}
+
+	err = r.Accept(someone, "ci.remote.moe")
+	if err == nil {
+		t.Fatalf("someone was able to accept a name not offered to them")
+	}
+
+	err = r.Accept(rotated, "ci.remote.moe")
+	if err != nil {
+		t.Fatalf("unable to accept: %s", err)
+	}
+
+	names, _ = r.Names(old)
+	if len(names) != 0 {
+		t.Fatalf("old key still has names: %+v", names)
+	}
+
+	names, _ = r.Names(rotated)
+	if len(names) != 1 || names[0].Target != rotated.FQDN() {
+		t.Fatalf("new key did not receive the name: %+v", names)
+	}
+
+	// offers are used up
+	err = r.Accept(rotated, "ci.remote.moe")
+	if err == nil {
+		t.Fatalf("offer was accepted twice")
+	}
+
+	transferred := false
+	for len(events) > 0 {
+		e := <-events
+		transferred = transferred || (e.Type == NameTransferred && e.Owner == rotated.FQDN())
+	}
+
+	if !transferred {
+		t.Fatalf("no transfer event was emitted")
+	}
+
+	// transfers survive restarts
+	r = newTestRouter(t, d)
+
+	names, _ = r.Names(rotated)
+	if len(names) != 1 {
+		t.Fatalf("transfer was not stored: %+v", names)
+	}
+
+	// offers of names that changed hands in the meantime are void
+	err = r.Transfer(rotated, "ci.remote.moe", someone.FQDN())
+	if err != nil {
+		t.Fatalf("unable to transfer: %s", err)
+	}
+
+	err = r.RemoveName("ci.remote.moe", rotated)
+	if err != nil {
+		t.Fatalf("unable to remove name: %s", err)
+	}
+
+	err = r.AddName(NewName("ci.remote.moe", old))
+	if err != nil {
+		t.Fatalf("unable to add name: %s", err)
+	}
+
+	err = r.Accept(someone, "ci.remote.moe")
+	if err == nil {
+		t.Fatalf("someone accepted an offer of a name that changed hands")
+	}
+}
@@ -0,0 +1,128 @@
+package routertwo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidName is returned when trying to add names that are not valid hostnames
+var ErrInvalidName = errors.New("invalid hostname")
+
+// ErrReservedName is returned when trying to add names that the operator have reserved
+var ErrReservedName = errors.New("reserved hostname")
+
+const (
+	maxNameLength  = 253
+	maxLabelLength = 63
+
+	// keyLabelLength is the length of the base32 encoded sha256 sums, keys are known by
+	keyLabelLength = 52
+)
+
+// WithReserved reserves names such that they cannot be added as NamedRoutes. Reserving
+// a wildcard, e.g. *.example.com, reserves every subdomain of example.com as well
+func WithReserved(names ...string) Option {
+	return func(r *Router) {
+		for _, n := range names {
+			r.reserved = append(r.reserved, strings.ToLower(n))
+		}
+	}
+}
+
+// WithKeyDomain tells the router that keys are known by hostnames directly below domain, e.g.
+// <fingerprint>.remote.moe - such hostnames are kept for the keys, even before they have been seen
+func WithKeyDomain(domain string) Option {
+	return func(r *Router) {
+		r.keyDomain = strings.ToLower(domain)
+	}
+}
+
+// ValidateName checks that name is a fully qualified hostname, made of RFC 1123 labels,
+// optionally with a leading wildcard label
+func ValidateName(name string) error {
+	if len(name) > maxNameLength {
+		return fmt.Errorf("%w: %s is longer than %d characters", ErrInvalidName, name, maxNameLength)
+	}
+
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 {
+		return fmt.Errorf("%w: %s is not fully qualified, e.g. host.domain.tld", ErrInvalidName, name)
+	}
+
+	for i, label := range labels {
+		// only the leftmost label may be a wildcard
+		if i == 0 && label == "*" {
+			continue
+		}
+
+		err := validateLabel(label)
+		if err != nil {
+			return fmt.Errorf("%w: %s %s", ErrInvalidName, name, err)
+		}
+	}
+
+	return nil
+}
+
+func validateLabel(label string) error {
+	if len(label) == 0 {
+		return fmt.Errorf("contains an empty label")
+	}
+
+	if len(label) > maxLabelLength {
+		return fmt.Errorf("has a label longer than %d characters", maxLabelLength)
+	}
+
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return fmt.Errorf("has a label starting or ending with a hyphen")
+	}
+
+	for _, c := range label {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return fmt.Errorf("contains %q, only letters, digits and hyphens are allowed", c)
+		}
+	}
+
+	return nil
+}
+
+// isReserved reports whether name is, or is covered by a reserved name - wildcards are also
+// reserved when they would cover a reserved name, or its subdomains
+func (r *Router) isReserved(name string) bool {
+	for _, reserved := range r.reserved {
+		if name == reserved {
+			return true
+		}
+
+		if IsWildcard(reserved) && covers(reserved, name) {
+			return true
+		}
+
+		if IsWildcard(name) && (covers(name, reserved) || name[len(wildcardPrefix):] == reserved) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isKeyName reports whether name looks like the hostname of a key
+func (r *Router) isKeyName(name string) bool {
+	if r.keyDomain == "" || !strings.HasSuffix(name, "."+r.keyDomain) {
+		return false
+	}
+
+	label := strings.TrimSuffix(name, "."+r.keyDomain)
+	if len(label) != keyLabelLength {
+		return false
+	}
+
+	for _, c := range label {
+		if (c < 'a' || c > 'z') && (c < '2' || c > '7') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,175 @@
+package routertwo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// ErrPending is returned when dialing names which have not been verified yet
+var ErrPending = errors.New("pending verification")
+
+// verifyTimeout is how long a single verification may take
+const verifyTimeout = 5 * time.Second
+
+// verifyPrefix is prepended to names when looking up their TXT records
+const verifyPrefix = "_remotemoe."
+
+// TXTResolver looks up TXT records, *net.Resolver is one
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// NewResolver returns a *net.Resolver which asks the dns server at addr, e.g. 127.0.0.1:53
+func NewResolver(addr string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// Verifier verifies that owners of names outside Domain, control the dns of the name
+// by looking for a TXT record on _remotemoe.<name> containing the owners fingerprint
+type Verifier struct {
+	Resolver TXTResolver
+
+	// Domain is where names are handed out freely, i.e. services.Hostname
+	Domain string
+}
+
+// WithVerifier makes names outside the verifiers Domain stay pending until verified
+func WithVerifier(v *Verifier) Option {
+	return func(r *Router) {
+		r.verifier = v
+	}
+}
+
+// Required reports whether name needs verification
+func (v *Verifier) Required(name string) bool {
+	return name != v.Domain && !strings.HasSuffix(name, "."+v.Domain)
+}
+
+// Record returns the TXT record name and value that will verify n
+func (v *Verifier) Record(n *NamedRoute) (string, string) {
+	return verifyPrefix + strings.TrimPrefix(n.Name, wildcardPrefix), fingerprint(n.target())
+}
+
+// Verify returns nil if the TXT record of n is in place
+func (v *Verifier) Verify(ctx context.Context, n *NamedRoute) error {
+	name, value := v.Record(n)
+
+	records, err := v.Resolver.LookupTXT(ctx, name)
+	if err != nil {
+		return fmt.Errorf("unable to lookup %s: %w", name, err)
+	}
+
+	for _, record := range records {
+		if strings.TrimSpace(record) == value {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s does not contain %s", name, value)
+}
+
+// fingerprint returns the fingerprint part of a keys FQDN
+func fingerprint(key string) string {
+	return strings.SplitN(key, ".", 2)[0]
+}
+
+// pending reports whether n should be pending, trying to verify it if needed
+func (r *Router) pending(n *NamedRoute) bool {
+	if r.verifier == nil || !r.verifier.Required(n.Name) {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), verifyTimeout)
+	defer cancel()
+
+	return r.verifier.Verify(ctx, n) != nil
+}
+
+// VerifyRecord returns the TXT record name and value needed to verify n, if verification is enabled
+func (r *Router) VerifyRecord(n *NamedRoute) (string, string, bool) {
+	if r.verifier == nil {
+		return "", "", false
+	}
+
+	name, value := r.verifier.Record(n)
+	return name, value, true
+}
+
+// VerifyPending tries to verify every pending name and path, and activates those that are
+func (r *Router) VerifyPending() {
+	verified := make([]Routable, 0)
+	for _, rtbl := range r.table() {
+		switch route := rtbl.(type) {
+		case *NamedRoute:
+			if route.Pending && !r.pending(route) {
+				verified = append(verified, route)
+			}
+		case *PathRoute:
+			if route.Pending && !r.pending(route.claim()) {
+				verified = append(verified, route)
+			}
+		}
+	}
+
+	if len(verified) == 0 {
+		return
+	}
+
+	next := r.begin()
+	defer r.finish()
+
+	activated := make([]Routable, 0, len(verified))
+	for _, rtbl := range verified {
+		// the route could have been removed or replaced while we where verifying
+		if next[rtbl.FQDN()] != rtbl {
+			continue
+		}
+
+		var err error
+		switch route := rtbl.(type) {
+		case *NamedRoute:
+			err = r.replaceName(next, route, func(active *NamedRoute) {
+				active.Pending = false
+			})
+		case *PathRoute:
+			err = r.replacePath(next, route, func(active *PathRoute) {
+				active.Pending = false
+			})
+		}
+
+		if err != nil {
+			log.Printf("router: unable to activate verified route: %s", err)
+			continue
+		}
+
+		activated = append(activated, next[rtbl.FQDN()])
+	}
+
+	r.exchange(next)
+
+	for _, rtbl := range activated {
+		r.emit(NameVerified, rtbl)
+		r.notify(r.owner(rtbl), fmt.Sprintf("%s was verified and is now active", rtbl.FQDN()))
+	}
+}
+
+// VerifyEvery runs VerifyPending every interval - it never returns
+func (r *Router) VerifyEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		r.VerifyPending()
+	}
+}
@@ -0,0 +1,238 @@
+package routertwo
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsStandIn is a tiny dns server, answering TXT questions from its records
+type dnsStandIn struct {
+	conn net.PacketConn
+
+	sync.Mutex
+	records map[string][]string
+}
+
+func newDNSStandIn(t *testing.T) *dnsStandIn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen for dns: %s", err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	d := &dnsStandIn{conn: conn, records: make(map[string][]string)}
+	go d.serve()
+
+	return d
+}
+
+func (d *dnsStandIn) set(name string, values ...string) {
+	d.Lock()
+	d.records[name+"."] = values
+	d.Unlock()
+}
+
+func (d *dnsStandIn) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := d.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		var p dnsmessage.Parser
+		h, err := p.Start(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		q, err := p.Question()
+		if err != nil {
+			continue
+		}
+
+		d.Lock()
+		values, exists := d.records[q.Name.String()]
+		d.Unlock()
+
+		header := dnsmessage.Header{ID: h.ID, Response: true, Authoritative: true}
+		if !exists {
+			header.RCode = dnsmessage.RCodeNameError
+		}
+
+		b := dnsmessage.NewBuilder(nil, header)
+		b.StartQuestions()
+		b.Question(q)
+		b.StartAnswers()
+
+		if q.Type == dnsmessage.TypeTXT {
+			for _, v := range values {
+				b.TXTResource(
+					dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET},
+					dnsmessage.TXTResource{TXT: []string{v}},
+				)
+			}
+		}
+
+		msg, err := b.Finish()
+		if err != nil {
+			continue
+		}
+
+		d.conn.WriteTo(msg, addr)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dns := newDNSStandIn(t)
+
+	verifier := &Verifier{Resolver: NewResolver(dns.conn.LocalAddr().String()), Domain: "remote.moe"}
+	r := newTestRouter(t, t.TempDir(), WithVerifier(verifier))
+
+	owner := &OtherRoutable{name: "owner.remote.moe"}
+	r.Online(owner)
+
+	// names inside remotemoe's own domain are never pending
+	name := NewName("free.remote.moe", owner)
+	err := r.AddName(name)
+	if err != nil || name.Pending {
+		t.Fatalf("expected free.remote.moe to be active: %s", err)
+	}
+
+	name = NewName("app.example.com", owner)
+	err = r.AddName(name)
+	if err != nil {
+		t.Fatalf("unable to add name: %s", err)
+	}
+
+	if !name.Pending {
+		t.Fatalf("expected app.example.com to be pending")
+	}
+
+	_, err = r.DialContext(context.TODO(), "tcp", "app.example.com:80")
+	if !errors.Is(err, ErrPending) {
+		t.Fatalf("expected pending error, got: %s", err)
+	}
+
+	// autocert must not be issuing certificates for pending names
+	err = r.Exists(context.TODO(), "app.example.com")
+	if !errors.Is(err, ErrPending) {
+		t.Fatalf("expected pending error, got: %s", err)
+	}
+
+	record, value, _ := r.VerifyRecord(name)
+	if record != "_remotemoe.app.example.com" || value != "owner" {
+		t.Fatalf("unexpected verification record: %s %s", record, value)
+	}
+
+	// someone else's fingerprint does not count
+	dns.set(record, "someone")
+	r.VerifyPending()
+
+	err = r.Exists(context.TODO(), "app.example.com")
+	if !errors.Is(err, ErrPending) {
+		t.Fatalf("expected pending error, got: %s", err)
+	}
+
+	dns.set(record, "someone", value)
+	r.VerifyPending()
+
+	_, err = r.DialContext(context.TODO(), "tcp", "app.example.com:80")
+	if !errors.Is(err, errDummy) {
+		t.Fatalf("expected app.example.com to be active, got: %s", err)
+	}
+
+	names, _ := r.Names(owner)
+	if len(names) != 2 || names[1].Pending {
+		t.Fatalf("expected two active names, got: %+v", names)
+	}
+
+	// a pending name does not keep the rightful owner from claiming it
+	squatter := &OtherRoutable{name: "squatter.remote.moe"}
+	err = r.AddName(NewName("shop.example.com", squatter))
+	if err != nil {
+		t.Fatalf("unable to add pending name: %s", err)
+	}
+
+	// nor does it get displaced by other pending claims
+	err = r.AddName(NewName("shop.example.com", owner))
+	if err == nil {
+		t.Fatalf("a pending claim displaced another pending claim")
+	}
+
+	dns.set("_remotemoe.shop.example.com", value)
+
+	name = NewName("shop.example.com", owner)
+	err = r.AddName(name)
+	if err != nil {
+		t.Fatalf("rightful owner was unable to claim pending name: %s", err)
+	}
+
+	if name.Pending {
+		t.Fatalf("expected shop.example.com to be verified right away")
+	}
+
+	names, _ = r.Names(squatter)
+	if len(names) != 0 {
+		t.Fatalf("squatter still has names: %+v", names)
+	}
+
+	// but active names, still does
+	err = r.AddName(NewName("shop.example.com", squatter))
+	if err == nil {
+		t.Fatalf("squatter was able to claim an active name")
+	}
+}
+
+func TestPendingWildcard(t *testing.T) {
+	dns := newDNSStandIn(t)
+
+	verifier := &Verifier{Resolver: NewResolver(dns.conn.LocalAddr().String()), Domain: "remote.moe"}
+	r := newTestRouter(t, t.TempDir(), WithVerifier(verifier))
+
+	victim := &OtherRoutable{name: "victim.remote.moe"}
+	squatter := &OtherRoutable{name: "squatter.remote.moe"}
+	r.Online(victim)
+	r.Online(squatter)
+
+	wildcard := NewName("*.victim.com", squatter)
+	err := r.AddName(wildcard)
+	if err != nil || !wildcard.Pending {
+		t.Fatalf("expected *.victim.com to be pending: %s", err)
+	}
+
+	// an unverified wildcard does not keep pending claims out
+	err = r.AddName(NewName("www.victim.com", victim))
+	if err == nil {
+		t.Fatalf("a pending claim was added inside the pending wildcard of someone else")
+	}
+
+	// but does not stand in the way of verified claims, names or paths
+	dns.set("_remotemoe.www.victim.com", "victim")
+
+	name := NewName("www.victim.com", victim)
+	err = r.AddName(name)
+	if err != nil || name.Pending {
+		t.Fatalf("verified claim was blocked by a pending wildcard: %s", err)
+	}
+
+	dns.set("_remotemoe.shop.victim.com", "victim")
+
+	p, _ := NewPath("shop.victim.com/api", victim)
+	err = r.AddPath(p)
+	if err != nil || p.Pending {
+		t.Fatalf("verified path was blocked by a pending wildcard: %s", err)
+	}
+
+	// the rightful owner of the name is still routed to
+	target, _ := r.Find("www.victim.com")
+	if target.(*NamedRoute).Owner != victim.FQDN() {
+		t.Fatalf("expected www.victim.com to belong to victim")
+	}
+}
@@ -0,0 +1,89 @@
+package routertwo
+
+import (
+	"fmt"
+	"time"
+)
+
+// tombstoneRetention is how long removed records are remembered. Nodes of a cluster that have been
+// disconnected for longer, may bring records removed in the meantime back
+const tombstoneRetention = 30 * 24 * time.Hour
+
+// Version orders changes to a record across the nodes of a cluster. Each node counts the changes it
+// makes, and keeps its clock ahead of every version it have seen - the change with the highest clock
+// wins, and changes made at the same time are told apart by the name of their node
+type Version struct {
+	Clock uint64 `json:"clock"`
+	Node  string `json:"node,omitempty"`
+}
+
+// newer reports whether v is a later change than o
+func (v Version) newer(o Version) bool {
+	if v.Clock != o.Clock {
+		return v.Clock > o.Clock
+	}
+
+	return v.Node > o.Node
+}
+
+// Tombstone is left behind by removed records, such that nodes which missed the removal,
+// does not bring the record back
+type Tombstone struct {
+	// Name is the name of the removed record
+	Name string `json:"name"`
+
+	Removed time.Time `json:"removed"`
+}
+
+// version returns the version of the record, records from before versions where introduced are the oldest
+func (i *Intermediate) version() Version {
+	if i.Version == nil {
+		return Version{}
+	}
+
+	return *i.Version
+}
+
+// tick returns the version of a change made by this node
+func (r *Router) tick() *Version {
+	r.clock++
+	return &Version{Clock: r.clock, Node: r.node}
+}
+
+// observe keeps the clock of this node ahead of v
+func (r *Router) observe(v Version) {
+	if v.Clock > r.clock {
+		r.clock = v.Clock
+	}
+}
+
+// remember keeps track of the version of the record n, and whether it is a tombstone
+func (r *Router) remember(n string, i *Intermediate) {
+	r.observe(i.version())
+	r.versions[n] = i.version()
+
+	if i.Tombstone != nil {
+		r.tombstones[n] = i.Tombstone
+	} else {
+		delete(r.tombstones, n)
+	}
+}
+
+// prune forgets tombstones which have been kept for long enough, r must be locked
+func (r *Router) prune(now time.Time) error {
+	for n, t := range r.tombstones {
+		if now.Sub(t.Removed) < tombstoneRetention {
+			continue
+		}
+
+		err := r.db.Delete(n)
+		if err != nil {
+			return fmt.Errorf("unable to remove tombstone of %s: %w", n, err)
+		}
+
+		delete(r.tombstones, n)
+		delete(r.versions, n)
+	}
+
+	return nil
+}
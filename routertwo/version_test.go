@@ -0,0 +1,109 @@
+package routertwo
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// clusterStandIn records the changes passed on to the cluster
+type clusterStandIn struct {
+	sync.Mutex
+	records map[string][]byte
+}
+
+func (c *clusterStandIn) Put(name string, data []byte) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.records[name] = data
+}
+
+func (c *clusterStandIn) DialContext(_ context.Context, _, _, _ string) (net.Conn, error) {
+	return nil, errDummy
+}
+
+func TestTombstones(t *testing.T) {
+	d := t.TempDir()
+	c := &clusterStandIn{records: make(map[string][]byte)}
+	r := newTestRouter(t, d, WithCluster("a", c))
+
+	owner := &OtherRoutable{name: "owner.remote.moe"}
+	r.Online(owner)
+
+	err := r.AddName(NewName("example.remote.moe", owner))
+	if err != nil {
+		t.Fatalf("unable to add name: %s", err)
+	}
+
+	added := c.records["example.remote.moe"]
+
+	err = r.RemoveName("example.remote.moe", owner)
+	if err != nil {
+		t.Fatalf("unable to remove name: %s", err)
+	}
+
+	var removed Intermediate
+	err = json.Unmarshal(c.records["example.remote.moe"], &removed)
+	if err != nil || removed.Tombstone == nil || !removed.version().newer(Version{Clock: 1, Node: "a"}) {
+		t.Fatalf("expected a tombstone to be passed on, got %s: %v", c.records["example.remote.moe"], err)
+	}
+
+	// the tombstone survives restarts, and keeps the name from coming back
+	r = newTestRouter(t, d, WithCluster("a", c))
+
+	err = r.Apply(added)
+	if err != nil {
+		t.Fatalf("unable to apply name: %s", err)
+	}
+
+	_, exists := r.Find("example.remote.moe")
+	if exists {
+		t.Fatalf("an older change brought the removed name back")
+	}
+
+	// later changes from other nodes are applied, and changes made here are later still
+	later, _ := json.Marshal(&Intermediate{
+		NamedRoute: &NamedRoute{Name: "example.remote.moe", Owner: "other.remote.moe", Target: "other.remote.moe"},
+		Version:    &Version{Clock: 100, Node: "b"},
+	})
+
+	err = r.Apply(later)
+	if err != nil {
+		t.Fatalf("unable to apply name: %s", err)
+	}
+
+	_, exists = r.Find("example.remote.moe")
+	if !exists {
+		t.Fatalf("expected a later change to be applied")
+	}
+
+	err = r.AddName(NewName("other.remote.moe", owner))
+	if err != nil {
+		t.Fatalf("unable to add name: %s", err)
+	}
+
+	var i Intermediate
+	json.Unmarshal(c.records["other.remote.moe"], &i)
+	if i.version().Clock <= 100 {
+		t.Fatalf("expected change to be later than changes seen, got %+v", i.Version)
+	}
+
+	// tombstones are forgotten after a while
+	err = r.RemoveName("other.remote.moe", owner)
+	if err != nil {
+		t.Fatalf("unable to remove name: %s", err)
+	}
+
+	_, err = r.Expire(time.Now().Add(tombstoneRetention + time.Hour))
+	if err != nil {
+		t.Fatalf("unable to expire: %s", err)
+	}
+
+	if len(r.tombstones) != 0 {
+		t.Fatalf("expected tombstones to be forgotten, got %+v", r.tombstones)
+	}
+}
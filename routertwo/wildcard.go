@@ -0,0 +1,110 @@
+package routertwo
+
+import (
+	"strings"
+)
+
+// wildcardPrefix is the leftmost label of wildcard names, e.g. *.mybranch.example.com
+const wildcardPrefix = "*."
+
+// IsWildcard reports whether name is a wildcard name
+func IsWildcard(name string) bool {
+	return strings.HasPrefix(name, wildcardPrefix)
+}
+
+// covers reports whether the wildcard matches name - wildcards matches any
+// subdomain, at any depth, but not the domain itself
+func covers(wildcard, name string) bool {
+	return strings.HasSuffix(name, wildcard[len(wildcardPrefix)-1:])
+}
+
+// Covers reports whether name is covered by the wildcard
+func Covers(wildcard, name string) bool {
+	return IsWildcard(wildcard) && covers(wildcard, name)
+}
+
+// lookup finds host in table, falling back to the most specific wildcard which covers host
+func lookup(table map[string]Routable, host string) (Routable, bool) {
+	d, exists := table[host]
+	if exists {
+		return d, true
+	}
+
+	for rest := host; ; {
+		i := strings.IndexByte(rest, '.')
+		if i == -1 {
+			return nil, false
+		}
+
+		rest = rest[i+1:]
+
+		d, exists = table[wildcardPrefix+rest]
+		if exists {
+			return d, true
+		}
+	}
+}
+
+// owner returns who owns a route - hosts own them selves, or are owned by their account
+func (r *Router) owner(rtbl Routable) string {
+	switch route := rtbl.(type) {
+	case *NamedRoute:
+		return route.Owner
+	case *PathRoute:
+		return route.Owner
+	}
+
+	return r.ownerOf(rtbl.FQDN())
+}
+
+// isPending reports whether rtbl is a route pending verification
+func isPending(rtbl Routable) bool {
+	switch route := rtbl.(type) {
+	case *NamedRoute:
+		return route.Pending
+	case *PathRoute:
+		return route.Pending
+	}
+
+	return false
+}
+
+// shadowed returns a route owned by someone else than n's owner, which n would shadow, or be shadowed by.
+// A wildcard may not cover routes owned by others, and no one may add names inside another owner's wildcard.
+// Routes pending verification does not stand in the way of verified claims
+func (r *Router) shadowed(table map[string]Routable, n *NamedRoute) (Routable, bool) {
+	if IsWildcard(n.Name) {
+		for name, rtbl := range table {
+			// path routes are keyed by hostname and prefix, it is the hostname that is covered
+			if p, ok := rtbl.(*PathRoute); ok {
+				name = p.Name
+			}
+
+			if !n.Pending && isPending(rtbl) {
+				continue
+			}
+
+			if name != n.Name && covers(n.Name, name) && r.owner(rtbl) != n.Owner {
+				return rtbl, true
+			}
+		}
+	}
+
+	for rest := n.Name; ; {
+		i := strings.IndexByte(rest, '.')
+		if i == -1 {
+			return nil, false
+		}
+
+		rest = rest[i+1:]
+
+		rtbl, exists := table[wildcardPrefix+rest]
+		if !exists || (!n.Pending && isPending(rtbl)) {
+			continue
+		}
+
+		if rtbl.FQDN() != n.Name && r.owner(rtbl) != n.Owner {
+			return rtbl, true
+		}
+	}
+}
@@ -2,37 +2,336 @@ package ssh
 
 import (
 	"net"
+	"os"
+	"strconv"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/ssh"
 )
 
-// ChannelConn embedds a ssh.Channel and implements dummy methods to fulfill the net.Conn interface
+// Addr is the address of one end of a connection tunneled through ssh
+type Addr struct {
+	Host string
+	Port uint32
+}
+
+// Network returns "ssh"
+func (a Addr) Network() string {
+	return "ssh"
+}
+
+func (a Addr) String() string {
+	return net.JoinHostPort(a.Host, strconv.FormatUint(uint64(a.Port), 10))
+}
+
+// ParseAddr returns the Addr of address, e.g. example.remote.moe:80
+func ParseAddr(address string) (Addr, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return Addr{}, err
+	}
+
+	p, err := strconv.ParseUint(port, 10, 32)
+	if err != nil {
+		return Addr{}, err
+	}
+
+	return Addr{Host: host, Port: uint32(p)}, nil
+}
+
+// ChannelConn embedds a ssh.Channel and implements the rest of the net.Conn interface. ssh channels cannot
+// be interrupted, reads and writes with a deadline are done in the background, and left running should the
+// deadline pass - the next read or write picks up where they left. Without a deadline, reads and writes
+// goes straight to the channel, a deadline set and passing while they are blocked closes the channel
 type ChannelConn struct {
 	ssh.Channel
+
+	local  net.Addr
+	remote net.Addr
+
+	readLock     sync.Mutex
+	readDeadline *deadline
+	readBuf      []byte
+	readPending  chan readResult
+
+	// leftover is what was read in the background, but did not fit the buffer given to Read
+	leftover    []byte
+	leftoverErr error
+
+	// writes holds a token while a write is in progress
+	writes        chan struct{}
+	writeDeadline *deadline
+}
+
+type readResult struct {
+	n   int
+	err error
 }
 
-// LocalAddr is required by net.Conn
+// NewChannelConn returns a net.Conn on top of channel, with the addresses local and remote
+func NewChannelConn(channel ssh.Channel, local, remote net.Addr) *ChannelConn {
+	return &ChannelConn{
+		Channel:       channel,
+		local:         local,
+		remote:        remote,
+		readDeadline:  newDeadline(channel.Close),
+		writes:        make(chan struct{}, 1),
+		writeDeadline: newDeadline(channel.Close),
+	}
+}
+
+// LocalAddr returns the local address of the connection
 func (c *ChannelConn) LocalAddr() net.Addr {
-	return nil
+	return c.local
 }
 
-// RemoteAddr is required by net.Conn
+// RemoteAddr returns the remote address of the connection
 func (c *ChannelConn) RemoteAddr() net.Addr {
-	return nil
+	return c.remote
+}
+
+// Read reads from the channel, until the read deadline passes
+func (c *ChannelConn) Read(b []byte) (int, error) {
+	c.readLock.Lock()
+	defer c.readLock.Unlock()
+
+	if len(c.leftover) > 0 {
+		n := copy(b, c.leftover)
+		c.leftover = c.leftover[n:]
+
+		if len(c.leftover) == 0 {
+			return n, c.leftoverErr
+		}
+
+		return n, nil
+	}
+
+	if c.readPending == nil && c.readDeadline.enter() {
+		n, err := c.Channel.Read(b)
+		if c.readDeadline.leave() {
+			return n, os.ErrDeadlineExceeded
+		}
+
+		return n, err
+	}
+
+	if c.readPending == nil {
+		if len(c.readBuf) < len(b) {
+			c.readBuf = make([]byte, len(b))
+		}
+
+		buf := c.readBuf[:len(b)]
+		pending := make(chan readResult, 1)
+
+		go func() {
+			n, err := c.Channel.Read(buf)
+			pending <- readResult{n: n, err: err}
+		}()
+
+		c.readPending = pending
+	}
+
+	select {
+	case r := <-c.readPending:
+		c.readPending = nil
+
+		n := copy(b, c.readBuf[:r.n])
+		if n < r.n {
+			c.leftover = c.readBuf[n:r.n]
+			c.leftoverErr = r.err
+
+			return n, nil
+		}
+
+		return n, r.err
+	case <-c.readDeadline.wait():
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+// Write writes to the channel, until the write deadline passes
+func (c *ChannelConn) Write(b []byte) (int, error) {
+	select {
+	case c.writes <- struct{}{}:
+	case <-c.writeDeadline.wait():
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	if c.writeDeadline.enter() {
+		n, err := c.Channel.Write(b)
+		<-c.writes
+
+		if c.writeDeadline.leave() {
+			return n, os.ErrDeadlineExceeded
+		}
+
+		return n, err
+	}
+
+	// the write may outlive this call, and must not touch b when it does
+	buf := make([]byte, len(b))
+	copy(buf, b)
+
+	done := make(chan readResult, 1)
+	go func() {
+		n, err := c.Channel.Write(buf)
+		<-c.writes
+
+		done <- readResult{n: n, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.n, r.err
+	case <-c.writeDeadline.wait():
+		return 0, os.ErrDeadlineExceeded
+	}
 }
 
-// SetDeadline is required by net.Conn
-func (c *ChannelConn) SetDeadline(_ time.Time) error {
+// SetDeadline sets both the read and write deadlines
+func (c *ChannelConn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+
 	return nil
 }
 
-// SetReadDeadline is required by net.Conn
-func (c *ChannelConn) SetReadDeadline(_ time.Time) error {
+// SetReadDeadline sets the deadline of current and future reads
+func (c *ChannelConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
 	return nil
 }
 
-// SetWriteDeadline is required by net.Conn
-func (c *ChannelConn) SetWriteDeadline(_ time.Time) error {
+// SetWriteDeadline sets the deadline of current and future writes
+func (c *ChannelConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
 	return nil
 }
+
+// deadline is a channel closed when a point in time passes
+type deadline struct {
+	sync.Mutex
+	at     time.Time
+	timer  *time.Timer
+	passed chan struct{}
+
+	// direct counts calls in progress without a deadline, they can only be woken by interrupt
+	direct      int
+	interrupted bool
+	interrupt   func() error
+}
+
+func newDeadline(interrupt func() error) *deadline {
+	return &deadline{passed: make(chan struct{}), interrupt: interrupt}
+}
+
+// set moves the deadline to t, the zero time means no deadline
+func (d *deadline) set(t time.Time) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.at = t
+
+	// a timer that already fired, has closed passed
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.passed
+	}
+	d.timer = nil
+
+	closed := false
+	select {
+	case <-d.passed:
+		closed = true
+	default:
+	}
+
+	if t.IsZero() {
+		if closed {
+			d.passed = make(chan struct{})
+		}
+
+		return
+	}
+
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.passed = make(chan struct{})
+		}
+
+		passed := d.passed
+		d.timer = time.AfterFunc(dur, func() {
+			close(passed)
+			d.expire(passed)
+		})
+
+		return
+	}
+
+	if !closed {
+		close(d.passed)
+	}
+
+	d.wake()
+}
+
+// expire wakes direct calls as passed closes, unless the deadline have been moved since
+func (d *deadline) expire(passed chan struct{}) {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.passed == passed && !d.at.IsZero() {
+		d.wake()
+	}
+}
+
+// wake interrupts direct calls in progress, d must be locked
+func (d *deadline) wake() {
+	if d.direct == 0 || d.interrupted {
+		return
+	}
+
+	d.interrupted = true
+
+	// closing a channel involves sending a message, which should not hold the lock
+	go d.interrupt()
+}
+
+// enter reports whether a call can go straight to the channel, which it can when there is no deadline.
+// Calls entered must leave again when done
+func (d *deadline) enter() bool {
+	d.Lock()
+	defer d.Unlock()
+
+	if !d.at.IsZero() {
+		return false
+	}
+
+	d.direct++
+
+	return true
+}
+
+// leave reports whether the call was interrupted by a deadline passing
+func (d *deadline) leave() bool {
+	d.Lock()
+	defer d.Unlock()
+
+	interrupted := d.interrupted
+
+	// once every interrupted call have left, the channel reports being closed by it self
+	d.direct--
+	if d.direct == 0 {
+		d.interrupted = false
+	}
+
+	return interrupted
+}
+
+// wait returns a channel closed when the deadline passes
+func (d *deadline) wait() chan struct{} {
+	d.Lock()
+	defer d.Unlock()
+
+	return d.passed
+}
@@ -0,0 +1,209 @@
+package ssh
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// pipeChannel is a ssh.Channel on top of a net.Pipe, without deadlines of its own
+type pipeChannel struct {
+	net.Conn
+}
+
+func (p *pipeChannel) CloseWrite() error {
+	return nil
+}
+
+func (p *pipeChannel) SendRequest(_ string, _ bool, _ []byte) (bool, error) {
+	return false, nil
+}
+
+func (p *pipeChannel) Stderr() io.ReadWriter {
+	return nil
+}
+
+func TestChannelConnAddrs(t *testing.T) {
+	a, _ := net.Pipe()
+
+	c := NewChannelConn(&pipeChannel{a}, Addr{Host: "remote.moe", Port: 22}, Addr{Host: "example.remote.moe", Port: 80})
+
+	if c.LocalAddr().String() != "remote.moe:22" || c.RemoteAddr().String() != "example.remote.moe:80" {
+		t.Fatalf("unexpected addresses %s and %s", c.LocalAddr(), c.RemoteAddr())
+	}
+
+	addr, err := ParseAddr("example.remote.moe:443")
+	if err != nil || addr.Host != "example.remote.moe" || addr.Port != 443 {
+		t.Fatalf("unexpected address %+v: %s", addr, err)
+	}
+}
+
+func TestChannelConnDeadlines(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+
+	c := NewChannelConn(&pipeChannel{a}, nil, nil)
+
+	// nothing is written by the other end
+	c.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+
+	_, err := c.Read(make([]byte, 5))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected read to time out, got %v", err)
+	}
+
+	// the read timing out is still pending, and picks up data once the deadline is lifted
+	c.SetReadDeadline(time.Time{})
+
+	go b.Write([]byte("hello"))
+
+	buf := make([]byte, 3)
+	n, err := c.Read(buf)
+	if err != nil || string(buf[:n]) != "hel" {
+		t.Fatalf("unexpected read %q: %v", buf[:n], err)
+	}
+
+	n, err = c.Read(buf)
+	if err != nil || string(buf[:n]) != "lo" {
+		t.Fatalf("unexpected read %q: %v", buf[:n], err)
+	}
+
+	// nothing is read by the other end
+	c.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+
+	_, err = c.Write([]byte("hello"))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected write to time out, got %v", err)
+	}
+
+	// deadlines in the past fails right away
+	c.SetDeadline(time.Now().Add(-time.Second))
+
+	_, err = c.Read(buf)
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected read to time out, got %v", err)
+	}
+
+	// and are lifted again, the pending write goes through before the next one
+	c.SetDeadline(time.Time{})
+
+	go func() {
+		io.ReadFull(b, make([]byte, 8))
+		b.Write([]byte("moe"))
+	}()
+
+	_, err = c.Write([]byte("moe"))
+	if err != nil {
+		t.Fatalf("unable to write: %s", err)
+	}
+
+	n, err = c.Read(buf)
+	if err != nil || string(buf[:n]) != "moe" {
+		t.Fatalf("unexpected read %q: %v", buf[:n], err)
+	}
+}
+
+func TestChannelConnWithoutDeadlines(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+
+	c := NewChannelConn(&pipeChannel{a}, nil, nil)
+
+	go func() {
+		buf := make([]byte, 5)
+		io.ReadFull(b, buf)
+		b.Write(buf)
+	}()
+
+	_, err := c.Write([]byte("hello"))
+	if err != nil {
+		t.Fatalf("unable to write: %s", err)
+	}
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(c, buf)
+	if err != nil || string(buf) != "hello" {
+		t.Fatalf("unexpected read %q: %v", buf, err)
+	}
+
+	// reads without a deadline, goes straight to the channel
+	if c.readBuf != nil || c.readPending != nil {
+		t.Fatalf("expected reads without a deadline not to be done in the background")
+	}
+}
+
+func TestChannelConnWakeDirect(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+
+	c := NewChannelConn(&pipeChannel{a}, nil, nil)
+
+	// the read goes straight to the channel, and is blocked when the deadline is set
+	read := make(chan error, 1)
+	go func() {
+		_, err := c.Read(make([]byte, 5))
+		read <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	c.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+
+	select {
+	case err := <-read:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("expected read to time out, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("deadline did not wake the blocked read")
+	}
+
+	// as with reads, writes are woken by deadlines in the past as well
+	a, b = net.Pipe()
+	defer b.Close()
+
+	c = NewChannelConn(&pipeChannel{a}, nil, nil)
+
+	written := make(chan error, 1)
+	go func() {
+		_, err := c.Write([]byte("hello"))
+		written <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	c.SetWriteDeadline(time.Now().Add(-time.Second))
+
+	select {
+	case err := <-written:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("expected write to time out, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("deadline did not wake the blocked write")
+	}
+
+	// deadlines lifted before they pass, does not interrupt anything
+	a, b = net.Pipe()
+	defer b.Close()
+
+	c = NewChannelConn(&pipeChannel{a}, nil, nil)
+
+	go func() {
+		_, err := c.Read(make([]byte, 5))
+		read <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	c.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	c.SetReadDeadline(time.Time{})
+	time.Sleep(100 * time.Millisecond)
+
+	b.Write([]byte("hello"))
+
+	err := <-read
+	if err != nil {
+		t.Fatalf("unable to read: %s", err)
+	}
+}
@@ -9,7 +9,7 @@ import (
 )
 
 const forwardDiagram = `
-            +------------------------> remotemoe ignores bind_address
+            +------------------------> hostname the forward serves, all of them by default
             |        +---------------> specifies what kind of service is being forwarded
             |        |    +----------> destination host
             |        |    |     +----> destination port
@@ -31,6 +31,7 @@ func Forwards(d Forwarding) *cobra.Command {
 	fmt.Fprintf(help, "  Ports %s will be accessible with %s\n", joinDigits(services.Services["https"]), "HTTPs")
 	fmt.Fprintf(help, "  Ports %s will be accessible with %s\n", joinDigits(services.Services["ssh"]), "ssh")
 	fmt.Fprintf(help, "  Other ports can be accessed though ssh by using `ssh -L` or `ssh -W`\n")
+	fmt.Fprintf(help, "  Port 0 is given a public tcp port of its own, if the server hands out ports\n")
 
 	return &cobra.Command{
 		Use:   "forwards",
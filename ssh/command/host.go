@@ -2,6 +2,7 @@ package command
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/fasmide/remotemoe/routertwo"
 	"github.com/fasmide/remotemoe/ssh/command/host"
@@ -24,14 +25,53 @@ func Host(r routertwo.Routable, router *routertwo.Router) *cobra.Command {
 				return fmt.Errorf("unable to lookup your custom names: %w", err)
 			}
 
-			if len(namedRoutes) == 0 {
+			used, limit := router.Quota(r)
+			paths := router.Paths(r)
+
+			if len(namedRoutes) == 0 && len(paths) == 0 {
 				cmd.Printf("No active hostnames.\n")
-				return nil
+			} else {
+				cmd.Printf("Active hostnames:\n")
+				for _, nr := range namedRoutes {
+					line := nr.FQDN()
+
+					// names of linked keys may be routed to one of the other keys
+					if nr.Target != "" && nr.Target != r.FQDN() {
+						line += fmt.Sprintf(" (routed to %s)", nr.Target)
+					}
+
+					if nr.Balance != "" {
+						line += fmt.Sprintf(" (pool, %s)", nr.Balance)
+					}
+
+					if nr.Pending {
+						line += " (pending verification)"
+					}
+
+					if !nr.Expires.IsZero() {
+						line += fmt.Sprintf(" (expires in %s)", time.Until(nr.Expires).Round(time.Second))
+					}
+
+					cmd.Printf("%s\n", line)
+				}
+
+				for _, p := range paths {
+					line := p.FQDN()
+
+					if p.Target != r.FQDN() {
+						line += fmt.Sprintf(" (routed to %s)", p.Target)
+					}
+
+					if p.Pending {
+						line += " (pending verification)"
+					}
+
+					cmd.Printf("%s\n", line)
+				}
 			}
 
-			cmd.Printf("Active hostnames:\n")
-			for _, nr := range namedRoutes {
-				cmd.Printf("%s\n", nr.FQDN())
+			if limit > 0 {
+				cmd.Printf("\nUsing %d of %d hostnames.\n", used, limit)
 			}
 
 			return nil
@@ -40,6 +80,8 @@ func Host(r routertwo.Routable, router *routertwo.Router) *cobra.Command {
 
 	top.AddCommand(host.Remove(r, router))
 	top.AddCommand(host.Add(r, router))
+	top.AddCommand(host.Transfer(r, router))
+	top.AddCommand(host.Accept(r, router))
 
 	return top
 }
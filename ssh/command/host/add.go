@@ -2,6 +2,7 @@ package host
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/fasmide/remotemoe/routertwo"
 	"github.com/fasmide/remotemoe/services"
@@ -10,14 +11,39 @@ import (
 
 // Add returns a cobra.Command which can add custom hostnames
 func Add(r routertwo.Routable, router *routertwo.Router) *cobra.Command {
+	var ttl time.Duration
+	var balance string
+
 	c := &cobra.Command{
 		Use:   fmt.Sprintf("add host.%s [host2.domain.tld] ...", services.Hostname),
 		Short: "Add hostname(s)",
 		Args:  cobra.MinimumNArgs(1),
-		Long:  "Add hostname(s)\n\nAdd as many hostnames as needed.\nBring your own domains by setting up DNS records appropriately.",
+		Long: "Add hostname(s)\n\nAdd as many hostnames as needed.\nBring your own domains by setting up DNS records appropriately.\n" +
+			"Wildcards, like *.branch.domain.tld, route every subdomain that does not have a hostname of its own.\n" +
+			"Paths, like host.domain.tld/api, route http(s) requests below the path, letting several keys share a hostname.",
 		Run: func(cmd *cobra.Command, args []string) {
+			var b routertwo.Balance
+			if balance != "" {
+				var err error
+				b, err = routertwo.ParseBalance(balance)
+				if err != nil {
+					cmd.Printf("%s\n", err)
+					return
+				}
+			}
+
 			for _, n := range args {
+				if routertwo.IsPath(n) {
+					addPath(cmd, r, router, n)
+					continue
+				}
+
 				namedRoute := routertwo.NewName(n, r)
+				if ttl > 0 {
+					namedRoute.Expires = time.Now().Add(ttl)
+				}
+
+				namedRoute.Balance = b
 
 				err := router.AddName(namedRoute)
 				if err != nil {
@@ -25,10 +51,42 @@ func Add(r routertwo.Routable, router *routertwo.Router) *cobra.Command {
 					continue
 				}
 
+				if namedRoute.Pending {
+					record, value, _ := router.VerifyRecord(namedRoute)
+					cmd.Printf("%s is pending, add a TXT record on %s containing %s to verify it.\n", namedRoute.FQDN(), record, value)
+					continue
+				}
+
 				cmd.Printf("%s is active.\n", namedRoute.FQDN())
 			}
 		},
 	}
 
+	c.Flags().DurationVarP(&ttl, "ttl", "t", 0, "remove the hostname(s) again after this long, e.g. 24h")
+	c.Flags().StringVarP(&balance, "pool", "p", "", "distribute connections between every linked key, using round-robin or least-conn")
+	c.Flags().Lookup("pool").NoOptDefVal = string(routertwo.RoundRobin)
+
 	return c
 }
+
+// addPath adds a path route, e.g. host.domain.tld/api
+func addPath(cmd *cobra.Command, r routertwo.Routable, router *routertwo.Router, s string) {
+	pathRoute, err := routertwo.NewPath(s, r)
+	if err == nil {
+		err = router.AddPath(pathRoute)
+	}
+
+	if err != nil {
+		cmd.Printf("%s could not be added: %s\n", s, err)
+		return
+	}
+
+	if pathRoute.Pending {
+		// the hostname is what is verified, the same record verifies every path of it
+		record, value, _ := router.VerifyRecord(routertwo.NewName(pathRoute.Name, r))
+		cmd.Printf("%s is pending, add a TXT record on %s containing %s to verify it.\n", pathRoute.FQDN(), record, value)
+		return
+	}
+
+	cmd.Printf("%s is active, http(s) requests below it are routed here.\n", pathRoute.FQDN())
+}
@@ -16,7 +16,12 @@ func Remove(r routertwo.Routable, router *routertwo.Router) *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// try to remove all provided hosts
 			for _, name := range args {
-				err := router.RemoveName(name, r)
+				remove := router.RemoveName
+				if routertwo.IsPath(name) {
+					remove = router.RemovePath
+				}
+
+				err := remove(name, r)
 				if err != nil {
 					return fmt.Errorf("could not remove %s: %s", name, err)
 				}
@@ -0,0 +1,80 @@
+package host
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fasmide/remotemoe/routertwo"
+	"github.com/fasmide/remotemoe/services"
+	"github.com/spf13/cobra"
+)
+
+// Transfer returns a cobra.Command which offers a hostname to another key
+func Transfer(r routertwo.Routable, router *routertwo.Router) *cobra.Command {
+	return &cobra.Command{
+		Use:   "transfer host.domain.tld <fingerprint>",
+		Short: "Transfer a hostname to another key",
+		Long: "Transfer a hostname to another key\n\nThe hostname stays with you until the other key accepts it with \"host accept\".\n" +
+			"Use whoami to find the fingerprint of a key.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, key := args[0], KeyFQDN(args[1])
+
+			err := router.Transfer(r, name, key)
+			if err != nil {
+				return fmt.Errorf("could not transfer %s: %w", name, err)
+			}
+
+			cmd.Printf("%s offered to %s, accept it from there with:\n\n", name, key)
+			cmd.Printf("host accept %s\n", name)
+
+			return nil
+		},
+	}
+}
+
+// Accept returns a cobra.Command which accepts hostnames transferred to this key
+func Accept(r routertwo.Routable, router *routertwo.Router) *cobra.Command {
+	return &cobra.Command{
+		Use:   "accept [host.domain.tld] ...",
+		Short: "Accept transferred hostname(s)",
+		Long:  "Accept transferred hostname(s)\n\nWithout arguments, hostnames offered to this key are listed.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				offers := router.Offers(r)
+				if len(offers) == 0 {
+					cmd.Printf("No hostnames offered.\n")
+					return nil
+				}
+
+				cmd.Printf("Offered hostnames:\n")
+				for _, name := range offers {
+					cmd.Printf("%s\n", name)
+				}
+
+				return nil
+			}
+
+			for _, name := range args {
+				err := router.Accept(r, name)
+				if err != nil {
+					return fmt.Errorf("could not accept %s: %w", name, err)
+				}
+
+				cmd.Printf("%s is now yours.\n", name)
+			}
+
+			return nil
+		},
+	}
+}
+
+// KeyFQDN allows users to leave out the domain part of fingerprints
+func KeyFQDN(s string) string {
+	s = strings.ToLower(s)
+	if !strings.Contains(s, ".") {
+		return fmt.Sprintf("%s.%s", s, services.Hostname)
+	}
+
+	return s
+}
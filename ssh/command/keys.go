@@ -0,0 +1,92 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/fasmide/remotemoe/routertwo"
+	"github.com/fasmide/remotemoe/ssh/command/host"
+	"github.com/spf13/cobra"
+)
+
+// Keys returns a *cobra.Command that enables the user to link other keys with their own
+func Keys(r routertwo.Routable, router *routertwo.Router) *cobra.Command {
+	top := &cobra.Command{
+		Use:   "keys",
+		Short: "Manage linked keys",
+		Long: `Linked keys share their hostnames, which can be managed using any one of the keys.
+
+Use whoami to find the fingerprint of a key.`,
+	}
+
+	top.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List linked keys",
+		Run: func(cmd *cobra.Command, _ []string) {
+			keys := router.Keys(r)
+			if len(keys) == 1 {
+				cmd.Printf("No linked keys.\n")
+				return
+			}
+
+			cmd.Printf("Linked keys:\n")
+			for _, key := range keys {
+				if key == r.FQDN() {
+					cmd.Printf("%s (this key)\n", key)
+					continue
+				}
+
+				cmd.Printf("%s\n", key)
+			}
+		},
+	})
+
+	top.AddCommand(&cobra.Command{
+		Use:   "link <fingerprint>",
+		Short: "Link another key with this key",
+		Long: `Link another key with this key.
+
+Both keys have to link with each other, run "keys link <fingerprint>" from the other key as well.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key := host.KeyFQDN(args[0])
+
+			linked, err := router.Link(r, key)
+			if err != nil {
+				return fmt.Errorf("unable to link %s: %w", key, err)
+			}
+
+			if !linked {
+				cmd.Printf("Waiting for %s, link this key from there to complete:\n\n", key)
+				cmd.Printf("keys link %s\n", r.FQDN())
+				return nil
+			}
+
+			cmd.Printf("%s is now linked with this key.\n", key)
+
+			return nil
+		},
+	})
+
+	top.AddCommand(&cobra.Command{
+		Use:   "unlink <fingerprint>",
+		Short: "Unlink a key",
+		Long: `Unlink a key.
+
+Hostnames stay with the remaining keys, hostnames routing to the unlinked key are routed to this key instead.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key := host.KeyFQDN(args[0])
+
+			err := router.Unlink(r, key)
+			if err != nil {
+				return fmt.Errorf("unable to unlink %s: %w", key, err)
+			}
+
+			cmd.Printf("%s unlinked.\n", key)
+
+			return nil
+		},
+	})
+
+	return top
+}
@@ -34,6 +34,7 @@ func DefaultCmd(s *Session, r *routertwo.Router) *cobra.Command {
 	c.AddCommand(command.Session(s))
 	c.AddCommand(command.Host(s, r))
 	c.AddCommand(command.Access(s, r))
+	c.AddCommand(command.Keys(s, r))
 	c.AddCommand(command.Whoami(s))
 	c.AddCommand(command.Version())
 
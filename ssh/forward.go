@@ -0,0 +1,85 @@
+package ssh
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/fasmide/remotemoe/routertwo"
+	"github.com/fasmide/remotemoe/services"
+)
+
+// forward is a port forwarded by the client, along with the address the client asked to bind it to
+type forward struct {
+	// Addr is kept as the client sent it, clients tell forwards apart by address and port
+	Addr string
+	Port uint32
+
+	// Socket is the path of forwarded unix sockets, which are mapped to Port by their name
+	Socket string
+}
+
+// socketPort maps the name of a unix socket to a port, like services.Ports does the other way around -
+// sockets are named after either a service, e.g. http, or a port number, e.g. 443
+func socketPort(socket string) (uint32, error) {
+	name := strings.TrimSuffix(path.Base(socket), ".sock")
+
+	if ports, exists := services.Services[name]; exists {
+		return uint32(ports[0]), nil
+	}
+
+	p, err := strconv.ParseUint(name, 10, 16)
+	if err != nil || p == 0 {
+		return 0, fmt.Errorf("%s does not name a service, name sockets e.g. http, https, ssh or a port number", socket)
+	}
+
+	return uint32(p), nil
+}
+
+// name returns the hostname the forward is for, or "" if the forward is for any hostname. Clients bind
+// to their loopback address unless told otherwise, such addresses are not hostnames
+func (f forward) name() string {
+	switch f.Addr {
+	case "", "localhost", "*", "0.0.0.0", "::", "127.0.0.1", "::1":
+		return ""
+	}
+
+	return strings.ToLower(f.Addr)
+}
+
+// resolve finds the forward of port p best matching hostname - forwards for the hostname it self first,
+// then wildcards covering it, and at last forwards for any hostname
+func (s *Session) resolve(hostname string, p uint32) (forward, bool) {
+	s.servicesLock.RLock()
+	defer s.servicesLock.RUnlock()
+
+	var covering, any *forward
+	for f := range s.services {
+		if f.Port != p {
+			continue
+		}
+
+		f := f
+
+		name := f.name()
+		switch {
+		case name == "":
+			any = &f
+		case name == hostname:
+			return f, true
+		case routertwo.Covers(name, hostname):
+			covering = &f
+		}
+	}
+
+	if covering != nil {
+		return *covering, true
+	}
+
+	if any != nil {
+		return *any, true
+	}
+
+	return forward{}, false
+}
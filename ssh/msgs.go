@@ -29,6 +29,24 @@ type tcpIPForward struct {
 	Rport uint32
 }
 
+// tcpIPForwardReply is the reply to tcpip-forward requests for port 0, with the port allocated
+// See RFC4254 7.1 Requesting Port Forwarding
+type tcpIPForwardReply struct {
+	Port uint32
+}
+
+// streamLocalForward request - See OpenSSH's PROTOCOL 2.4 Unix domain socket forwarding
+// https://github.com/openssh/openssh-portable/blob/master/PROTOCOL
+type streamLocalForward struct {
+	SocketPath string
+}
+
+// forwardedStreamLocal channel - See OpenSSH's PROTOCOL 2.4 Unix domain socket forwarding
+type forwardedStreamLocal struct {
+	SocketPath string
+	Reserved   string
+}
+
 // https://tools.ietf.org/html/rfc4254#section-6.5
 type execCommand struct {
 	Command string
@@ -0,0 +1,61 @@
+package ssh
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// maxPorts is how many ports a single session may be handed
+const maxPorts = 16
+
+// PortRange is a range of public tcp ports, handed out to clients forwarding port 0
+type PortRange struct {
+	First uint32
+	Last  uint32
+}
+
+// ParsePortRange parses ranges like 40000-40999
+func ParsePortRange(s string) (*PortRange, error) {
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("%q is not a range of ports, e.g. 40000-40999", s)
+	}
+
+	first, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid first port: %w", err)
+	}
+
+	last, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid last port: %w", err)
+	}
+
+	if first == 0 || first > last {
+		return nil, fmt.Errorf("%q is not a range of ports, e.g. 40000-40999", s)
+	}
+
+	return &PortRange{First: uint32(first), Last: uint32(last)}, nil
+}
+
+// Listen listens on a free port of the range, starting from a random one
+func (r *PortRange) Listen() (net.Listener, uint32, error) {
+	size := r.Last - r.First + 1
+	offset := uint32(rand.Int63n(int64(size)))
+
+	for i := uint32(0); i < size; i++ {
+		p := r.First + (offset+i)%size
+
+		l, err := net.Listen("tcp", fmt.Sprintf(":%d", p))
+		if err != nil {
+			continue
+		}
+
+		return l, p, nil
+	}
+
+	return nil, 0, fmt.Errorf("no free ports between %d and %d", r.First, r.Last)
+}
@@ -0,0 +1,126 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParsePortRange(t *testing.T) {
+	r, err := ParsePortRange("40000-40999")
+	if err != nil || r.First != 40000 || r.Last != 40999 {
+		t.Fatalf("unexpected range %+v: %s", r, err)
+	}
+
+	for _, s := range []string{"40000", "0-10", "40999-40000", "40000-70000", "a-b"} {
+		_, err = ParsePortRange(s)
+		if err == nil {
+			t.Fatalf("expected %q to be rejected", s)
+		}
+	}
+}
+
+// echoClient forwards port 0, and echoes every connection forwarded to it
+func echoClient(t *testing.T, addr string) (ssh.Conn, uint32) {
+	conn, _ := newClient(t, addr)
+
+	ok, payload, err := conn.SendRequest("tcpip-forward", true, ssh.Marshal(tcpIPForward{Rport: 0}))
+	if err != nil || !ok {
+		t.Fatalf("unable to forward port: %t %v", ok, err)
+	}
+
+	var reply tcpIPForwardReply
+	err = ssh.Unmarshal(payload, &reply)
+	if err != nil {
+		t.Fatalf("unable to parse reply: %s", err)
+	}
+
+	return conn, reply.Port
+}
+
+// freePort returns a port which was free a moment ago
+func freePort(t *testing.T) uint32 {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %s", err)
+	}
+	defer l.Close()
+
+	return uint32(l.Addr().(*net.TCPAddr).Port)
+}
+
+func TestAllocatePort(t *testing.T) {
+	p := freePort(t)
+
+	_, l := newServer(t, &Server{Ports: &PortRange{First: p, Last: p}})
+	conn, allocated := echoClient(t, l.Addr().String())
+
+	if allocated != p {
+		t.Fatalf("expected port %d to be allocated, got %d", p, allocated)
+	}
+
+	c, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", p))
+	if err != nil {
+		t.Fatalf("unable to connect to allocated port: %s", err)
+	}
+
+	_, err = c.Write([]byte("hello"))
+	if err != nil {
+		t.Fatalf("unable to write: %s", err)
+	}
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(c, buf)
+	if err != nil || string(buf) != "hello" {
+		t.Fatalf("expected echo, got %q: %s", buf, err)
+	}
+
+	c.Close()
+
+	// the range is exhausted
+	_, _, err = (&PortRange{First: p, Last: p}).Listen()
+	if err == nil {
+		t.Fatalf("expected the only port of the range to be taken")
+	}
+
+	// and the port is given back as the session ends
+	conn.Close()
+
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		l, _, err := (&PortRange{First: p, Last: p}).Listen()
+		if err == nil {
+			l.Close()
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("port was not given back: %s", err)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMaxPorts(t *testing.T) {
+	_, l := newServer(t, &Server{Ports: &PortRange{First: 40000, Last: 49999}})
+	conn, _ := newClient(t, l.Addr().String())
+
+	for i := 0; i <= maxPorts; i++ {
+		ok, _, err := conn.SendRequest("tcpip-forward", true, ssh.Marshal(tcpIPForward{Rport: 0}))
+		if err != nil {
+			t.Fatalf("unable to forward port: %s", err)
+		}
+
+		if i < maxPorts && !ok {
+			t.Fatalf("port %d was rejected", i+1)
+		}
+
+		if i == maxPorts && ok {
+			t.Fatalf("session was handed more than %d ports", maxPorts)
+		}
+	}
+}
@@ -23,6 +23,12 @@ type Server struct {
 	Config *ssh.ServerConfig
 
 	Router *routertwo.Router
+
+	// DialTimeout limits how long clients are given to accept forwarded connections, zero means no limit
+	DialTimeout time.Duration
+
+	// Ports, if set, are handed out to clients forwarding port 0
+	Ports *PortRange
 }
 
 // Serve will accept ssh connections
@@ -59,6 +65,8 @@ func (s *Server) accept(c net.Conn) {
 		channelRequests: chans,
 		requests:        reqs,
 		router:          s.Router,
+		dialTimeout:     s.DialTimeout,
+		ports:           s.Ports,
 	}
 
 	session.Handle()
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,6 +23,9 @@ const IdleTimeout = time.Minute
 const KeepAliveInterval = time.Minute * 10
 const KeepAliveTimeout = time.Second * 15
 
+// DefaultDialTimeout is how long clients are given to accept forwarded connections, unless configured otherwise
+const DefaultDialTimeout = time.Second * 10
+
 // Session represents a ongoing SSH connection
 type Session struct {
 	// Raw socket
@@ -42,15 +46,26 @@ type Session struct {
 	// messages to the terminal (i.e. the user)
 	msgs chan string
 
-	// services list of forwarded port numbers
+	// services list of forwarded ports and the addresses they were bound to
 	// these are just indicators that the remote sent a tcpip-forward request sometime
-	services     map[uint32]struct{}
+	services     map[forward]struct{}
 	servicesLock sync.RWMutex
 
+	// listeners are public tcp ports allocated for this session, guarded by servicesLock
+	listeners map[uint32]net.Listener
+	ports     *PortRange
+
 	// registeOnce is used to register with the router when ever a
 	// forward is received ... but only once :)
 	registerOnce sync.Once
 
+	// dialTimeout limits how long the client is given to accept forwarded connections, zero means no limit
+	dialTimeout time.Duration
+
+	// ctx is cancelled as the session ends
+	ctx    context.Context
+	cancel context.CancelFunc
+
 	router *routertwo.Router
 }
 
@@ -64,7 +79,11 @@ func (s *Session) Handle() {
 	s.msgs = make(chan string, 50)
 
 	// initialize services map
-	s.services = make(map[uint32]struct{})
+	s.services = make(map[forward]struct{})
+	s.listeners = make(map[uint32]net.Listener)
+
+	// connections made on behalf of this session, should not outlive it
+	s.ctx, s.cancel = context.WithCancel(context.Background())
 
 	// if a connection havnt done anything useful within a minute, throw them away
 	s.idleTimeout = time.AfterFunc(IdleTimeout, s.Timeout)
@@ -81,6 +100,16 @@ func (s *Session) Handle() {
 	// we are going offline
 	s.router.Offline(s)
 
+	s.cancel()
+
+	// allocated ports are given back
+	s.servicesLock.Lock()
+	for p, l := range s.listeners {
+		l.Close()
+		delete(s.listeners, p)
+	}
+	s.servicesLock.Unlock()
+
 	// No reason to keep the timer active
 	s.DisableTimeout()
 
@@ -185,8 +214,8 @@ func (s *Session) Forwards() map[uint32]struct{} {
 	s.servicesLock.RLock()
 
 	v := make(map[uint32]struct{})
-	for p := range s.services {
-		v[p] = struct{}{}
+	for f := range s.services {
+		v[f.Port] = struct{}{}
 	}
 
 	s.servicesLock.RUnlock()
@@ -212,33 +241,99 @@ func (s *Session) handleRequests() {
 				continue
 			}
 
-			// store this port number in services - future Dial's to this session
-			// will know if the service is available by looking in there
-			s.servicesLock.Lock()
-			s.services[forwardInfo.Rport] = struct{}{}
-			s.servicesLock.Unlock()
-
-			// disable idle timeout now that the connection is actually useful
-			s.DisableTimeout()
-
-			// register with the router - only do this once
-			s.registerOnce.Do(func() {
-				// take over existing routes
-				replaced, err := s.router.Online(s)
+			// port 0 asks for a public port of its own
+			var reply []byte
+			if forwardInfo.Rport == 0 {
+				forwardInfo.Rport, err = s.listen(forwardInfo.Addr)
 				if err != nil {
-					// TODO: figure out a way to communicate with the end user
-					logger.Printf("%s: unable to set a session online: %s", s.clearConn.RemoteAddr(), err)
-					s.secureConn.Close()
+					logger.Printf("%s: unable to allocate port: %s", s.clearConn.RemoteAddr(), err)
+					s.Notify(fmt.Sprintf("unable to allocate a port: %s", err))
+					req.Reply(false, nil)
+					continue
 				}
 
-				if replaced {
-					warning := color.New(color.BgYellow, color.FgBlack, color.Bold)
-					warning.EnableColor()
-					s.msgs <- fmt.Sprintf("%s: this session replaced another session with the same publickey\n", warning.Sprint("warn"))
-				}
-			})
+				reply = ssh.Marshal(tcpIPForwardReply{Port: forwardInfo.Rport})
+			}
+
+			s.addForward(forward{Addr: forwardInfo.Addr, Port: forwardInfo.Rport})
+
+			req.Reply(true, reply)
+			continue
+		}
+
+		if req.Type == "streamlocal-forward@openssh.com" {
+			forwardInfo := streamLocalForward{}
+			err := ssh.Unmarshal(req.Payload, &forwardInfo)
+
+			if err != nil {
+				logger.Printf("%s: unable to unmarshal streamlocal information: %s", s.clearConn.RemoteAddr(), err)
+				req.Reply(false, nil)
+				continue
+			}
+
+			// sockets are named after the service they provide
+			p, err := socketPort(forwardInfo.SocketPath)
+			if err != nil {
+				s.Notify(err.Error())
+				req.Reply(false, nil)
+				continue
+			}
+
+			s.addForward(forward{Socket: forwardInfo.SocketPath, Port: p})
+
+			req.Reply(true, nil)
+			continue
+		}
+
+		if req.Type == "cancel-streamlocal-forward@openssh.com" {
+			forwardInfo := streamLocalForward{}
+			err := ssh.Unmarshal(req.Payload, &forwardInfo)
+
+			if err != nil {
+				logger.Printf("%s: unable to unmarshal cancel information: %s", s.clearConn.RemoteAddr(), err)
+				req.Reply(false, nil)
+				continue
+			}
+
+			p, err := socketPort(forwardInfo.SocketPath)
+			if err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+
+			f := forward{Socket: forwardInfo.SocketPath, Port: p}
+
+			_, ok := s.cancelForward(f)
+			if !ok {
+				req.Reply(false, nil)
+				continue
+			}
+
+			s.informCancel(f, false)
+
+			req.Reply(true, nil)
+			continue
+		}
+
+		if req.Type == "cancel-tcpip-forward" {
+			forwardInfo := tcpIPForward{}
+			err := ssh.Unmarshal(req.Payload, &forwardInfo)
+
+			if err != nil {
+				logger.Printf("%s: unable to unmarshal cancel information: %s", s.clearConn.RemoteAddr(), err)
+				req.Reply(false, nil)
+				continue
+			}
 
-			s.informForward(forwardInfo.Rport)
+			f := forward{Addr: forwardInfo.Addr, Port: forwardInfo.Rport}
+
+			allocated, ok := s.cancelForward(f)
+			if !ok {
+				req.Reply(false, nil)
+				continue
+			}
+
+			s.informCancel(f, allocated)
 
 			req.Reply(true, nil)
 			continue
@@ -251,36 +346,198 @@ func (s *Session) handleRequests() {
 
 }
 
+// addForward stores f in services, and sets the session online with its first forward
+func (s *Session) addForward(f forward) {
+	// store this port number in services - future Dial's to this session
+	// will know if the service is available by looking in there
+	s.servicesLock.Lock()
+	s.services[f] = struct{}{}
+	s.servicesLock.Unlock()
+
+	// disable idle timeout now that the connection is actually useful
+	s.DisableTimeout()
+
+	// register with the router - only do this once
+	s.registerOnce.Do(func() {
+		// take over existing routes, join the pool of them or wait for them to go away
+		var replaced, standby bool
+		var err error
+		if balance, pooled := s.pool(); pooled {
+			replaced, err = s.router.OnlinePool(s, balance)
+		} else if s.secureConn.User() == standbyUser {
+			standby, err = s.router.OnlineStandby(s)
+		} else {
+			replaced, err = s.router.Online(s)
+		}
+
+		if err != nil {
+			// TODO: figure out a way to communicate with the end user
+			logger.Printf("%s: unable to set a session online: %s", s.clearConn.RemoteAddr(), err)
+			s.secureConn.Close()
+		}
+
+		if replaced {
+			warning := color.New(color.BgYellow, color.FgBlack, color.Bold)
+			warning.EnableColor()
+			s.msgs <- fmt.Sprintf("%s: this session replaced another session with the same publickey\n", warning.Sprint("warn"))
+		}
+
+		if standby {
+			s.Notify("this session is on standby, it takes over when the session with the same publickey goes away")
+		}
+	})
+
+	s.informForward(f)
+}
+
+// poolUser is the ssh username, which puts sessions in pool mode
+const poolUser = "pool"
+
+// standbyUser is the ssh username, which keeps sessions on standby instead of replacing other sessions
+const standbyUser = "standby"
+
+// pool returns the balance requested by the user, if the session should be pooled with other sessions
+// using the same key. Users opt in by connecting as pool@, or pool+least-conn@ to pick the balance
+func (s *Session) pool() (routertwo.Balance, bool) {
+	user := s.secureConn.User()
+	if user == poolUser {
+		return routertwo.RoundRobin, true
+	}
+
+	if !strings.HasPrefix(user, poolUser+"+") {
+		return "", false
+	}
+
+	balance, err := routertwo.ParseBalance(strings.TrimPrefix(user, poolUser+"+"))
+	if err != nil {
+		s.Notify(fmt.Sprintf("%s, using %s", err, routertwo.RoundRobin))
+		return routertwo.RoundRobin, true
+	}
+
+	return balance, true
+}
+
+// routes reports whether name routes to this session
+func (s *Session) routes(name string) bool {
+	names, err := s.router.Names(s)
+	if err != nil {
+		return false
+	}
+
+	for _, n := range names {
+		if n.FQDN() == name || routertwo.Covers(n.FQDN(), name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cancelForward removes the forward f, reporting whether its port was an allocated port. The session
+// leaves the router along with its last forward
+func (s *Session) cancelForward(f forward) (bool, bool) {
+	s.servicesLock.Lock()
+
+	_, exists := s.services[f]
+	if !exists {
+		s.servicesLock.Unlock()
+		return false, false
+	}
+
+	delete(s.services, f)
+
+	l, allocated := s.listeners[f.Port]
+	if allocated {
+		l.Close()
+		delete(s.listeners, f.Port)
+	}
+
+	last := len(s.services) == 0
+	s.servicesLock.Unlock()
+
+	if last {
+		s.router.Offline(s)
+
+		// forwarding ports again, registers again
+		s.registerOnce = sync.Once{}
+	}
+
+	return allocated, true
+}
+
+// informCancel informs the user that the forward f is gone
+func (s *Session) informCancel(f forward, allocated bool) {
+	bold := color.New(color.Bold)
+	bold.EnableColor()
+
+	service, exists := services.Ports[int(f.Port)]
+	if !exists {
+		service = "other"
+	}
+
+	if allocated {
+		service = "tcp"
+	}
+
+	if f.name() != "" {
+		s.msgs <- fmt.Sprintf("%s (%d)\n%s is no longer forwarded\n", bold.Sprint(service), f.Port, f.name())
+		return
+	}
+
+	s.msgs <- fmt.Sprintf("%s (%d)\nno longer forwarded\n", bold.Sprint(service), f.Port)
+}
+
 // informForward informs the user that the forward request have been accepted and where its available
-func (s *Session) informForward(p uint32) {
+func (s *Session) informForward(f forward) {
 	bold := color.New(color.Bold)
 	bold.EnableColor()
 
+	p := f.Port
+
+	// forwards bound to a hostname, are available at that hostname only
+	fqdn := s.FQDN()
+	if f.name() != "" {
+		fqdn = f.name()
+
+		if !s.routes(fqdn) {
+			s.Notify(fmt.Sprintf("%s does not route to this session, add it with `host add %s`", fqdn, fqdn))
+		}
+	}
+
+	s.servicesLock.RLock()
+	_, allocated := s.listeners[p]
+	s.servicesLock.RUnlock()
+
+	if allocated {
+		s.msgs <- fmt.Sprintf("%s (%d)\n%s:%d\n", bold.Sprintf("tcp"), p, services.Hostname, p)
+		return
+	}
+
 	// first things first - do we know what to do with this portnumber?
 	service, exists := services.Ports[int(p)]
 	if !exists {
-		s.msgs <- fmt.Sprintf("%s (%d)\nssh -L%d:%s:%d %s\n", bold.Sprintf("other"), p, p, s.FQDN(), p, services.Hostname)
+		s.msgs <- fmt.Sprintf("%s (%d)\nssh -L%d:%s:%d %s\n", bold.Sprintf("other"), p, p, fqdn, p, services.Hostname)
 		return
 	}
 
 	switch service {
 	case "http": // http services
 		if p == 80 {
-			s.msgs <- fmt.Sprintf("%s (%d)\nhttp://%s/\n", bold.Sprintf("http"), p, s.FQDN())
+			s.msgs <- fmt.Sprintf("%s (%d)\nhttp://%s/\n", bold.Sprintf("http"), p, fqdn)
 		} else {
-			s.msgs <- fmt.Sprintf("%s (%d)\nhttp://%s:%d/\n", bold.Sprintf("http"), p, s.FQDN(), p)
+			s.msgs <- fmt.Sprintf("%s (%d)\nhttp://%s:%d/\n", bold.Sprintf("http"), p, fqdn, p)
 		}
 	case "https": // https services
 		if p == 443 {
-			s.msgs <- fmt.Sprintf("%s (%d)\nhttps://%s/\n", bold.Sprintf("https"), p, s.FQDN())
+			s.msgs <- fmt.Sprintf("%s (%d)\nhttps://%s/\n", bold.Sprintf("https"), p, fqdn)
 		} else {
-			s.msgs <- fmt.Sprintf("%s (%d)\nhttps://%s:%d/\n", bold.Sprintf("https"), p, s.FQDN(), p)
+			s.msgs <- fmt.Sprintf("%s (%d)\nhttps://%s:%d/\n", bold.Sprintf("https"), p, fqdn, p)
 		}
 	case "ssh": // ssh services
 		if p == 22 {
-			s.msgs <- fmt.Sprintf("%s (%d)\nssh -J %s %s\n", bold.Sprintf("ssh"), p, services.Hostname, s.FQDN())
+			s.msgs <- fmt.Sprintf("%s (%d)\nssh -J %s %s\n", bold.Sprintf("ssh"), p, services.Hostname, fqdn)
 		} else {
-			s.msgs <- fmt.Sprintf("%s (%d)\nssh -p%d -J %s:%d %s\n", bold.Sprintf("ssh"), p, p, services.Hostname, p, s.FQDN())
+			s.msgs <- fmt.Sprintf("%s (%d)\nssh -p%d -J %s:%d %s\n", bold.Sprintf("ssh"), p, p, services.Hostname, p, fqdn)
 		}
 	default:
 		s.msgs <- fmt.Sprintf("erhm port %d - a certain developer must be ashamed of it self :)", p)
@@ -297,8 +554,11 @@ func (s *Session) acceptForwardRequest(fr ssh.NewChannel) error {
 		return fmt.Errorf("unable to unmarshal forward information: %w", err)
 	}
 
+	ctx, cancel := s.dialContext(s.ctx)
+	defer cancel()
+
 	// lookup "hostname" in the router, fetch remote and pass data
-	conn, err := s.router.DialContext(context.Background(), "tcp", forwardInfo.To())
+	conn, err := s.router.DialContext(ctx, "tcp", forwardInfo.To())
 	if err != nil {
 		err = fmt.Errorf("cannot dial %s: %s", forwardInfo.To(), err)
 		fr.Reject(ssh.ConnectionFailed, fmt.Sprintf("cannot make connection: %s", err))
@@ -316,30 +576,108 @@ func (s *Session) acceptForwardRequest(fr ssh.NewChannel) error {
 
 	go ssh.DiscardRequests(requests)
 
-	go func() {
-		var group errgroup.Group
+	go pipe(channel, conn)
 
-		group.Go(func() error {
-			_, err := io.Copy(channel, conn)
-			return err
-		})
+	return nil
+}
 
-		group.Go(func() error {
-			_, err := io.Copy(conn, channel)
-			return err
-		})
+// listen allocates a public port for a forward bound to addr, connections to it are forwarded to the
+// client as if made to the port
+func (s *Session) listen(addr string) (uint32, error) {
+	if s.ports == nil {
+		return 0, fmt.Errorf("this server does not hand out ports")
+	}
+
+	s.servicesLock.RLock()
+	allocated := len(s.listeners)
+	s.servicesLock.RUnlock()
+
+	if allocated >= maxPorts {
+		return 0, fmt.Errorf("sessions cannot have more than %d ports", maxPorts)
+	}
+
+	l, p, err := s.ports.Listen()
+	if err != nil {
+		return 0, err
+	}
+
+	s.servicesLock.Lock()
+	defer s.servicesLock.Unlock()
+
+	// the session may have ended, or allocated other ports, while allocating
+	if s.ctx.Err() != nil {
+		l.Close()
+		return 0, s.ctx.Err()
+	}
+
+	if len(s.listeners) >= maxPorts {
+		l.Close()
+		return 0, fmt.Errorf("sessions cannot have more than %d ports", maxPorts)
+	}
 
-		group.Wait()
+	s.listeners[p] = l
 
-		conn.Close()
-		channel.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go s.forward(c, forward{Addr: addr, Port: p})
+		}
 	}()
 
-	return nil
+	return p, nil
 }
 
-// DialContext tries to dial connections though the ssh session
-// FIXME: figure out what to do with the Context
+// forward forwards c to the client, as if made to f
+func (s *Session) forward(c net.Conn, f forward) {
+	ctx, cancel := s.dialContext(routertwo.WithHostname(s.ctx, f.name()))
+	defer cancel()
+
+	conn, err := s.DialContext(ctx, "tcp", net.JoinHostPort(s.FQDN(), strconv.FormatUint(uint64(f.Port), 10)))
+	if err != nil {
+		logger.Printf("%s: unable to forward connection from %s: %s", s.clearConn.RemoteAddr(), c.RemoteAddr(), err)
+		c.Close()
+
+		return
+	}
+
+	pipe(c, conn)
+}
+
+// pipe copies everything back and forth between a and b, until both directions are done
+func pipe(a, b io.ReadWriteCloser) {
+	var group errgroup.Group
+
+	group.Go(func() error {
+		_, err := io.Copy(a, b)
+		return err
+	})
+
+	group.Go(func() error {
+		_, err := io.Copy(b, a)
+		return err
+	})
+
+	group.Wait()
+
+	a.Close()
+	b.Close()
+}
+
+// dialContext limits ctx by the dial timeout
+func (s *Session) dialContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.dialTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, s.dialTimeout)
+}
+
+// DialContext tries to dial connections though the ssh session. Clients not accepting the connection
+// before ctx is done or the dial timeout passes, are given up on
 func (s *Session) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
 	_, port, err := net.SplitHostPort(address)
 	if err != nil {
@@ -351,31 +689,84 @@ func (s *Session) DialContext(ctx context.Context, network, address string) (net
 		return nil, fmt.Errorf("unable to convert port number to int: %w", err)
 	}
 
-	// did the client forward this port prior to this request?
-	s.servicesLock.RLock()
-	_, isActive := s.services[uint32(p)]
-	s.servicesLock.RUnlock()
+	// did the client forward this port prior to this request? names dialed, picks between forwards
+	// bound to different hostnames
+	hostname := routertwo.Hostname(ctx)
 
+	f, isActive := s.resolve(hostname, uint32(p))
 	if !isActive {
-		return nil, fmt.Errorf("this client does not provide port %d", p)
+		return nil, fmt.Errorf("this client does not provide port %d for %s", p, hostname)
 	}
 
-	channel, reqs, err := s.secureConn.OpenChannel("forwarded-tcpip", ssh.Marshal(directTCPIP{
-		Addr:  "localhost",
-		Rport: uint32(p),
-	}))
+	ctx, cancel := s.dialContext(ctx)
+	defer cancel()
 
-	if err != nil {
-		return nil, fmt.Errorf("could not open remote channel: %w", err)
+	type opened struct {
+		channel ssh.Channel
+		err     error
 	}
 
-	go ssh.DiscardRequests(reqs)
+	// opening channels cannot be cancelled, channels opened too late are closed as they arrive
+	done := make(chan opened, 1)
+	go func() {
+		channelType, payload := "forwarded-tcpip", ssh.Marshal(directTCPIP{
+			Addr:  f.Addr,
+			Rport: f.Port,
+		})
+
+		if f.Socket != "" {
+			channelType, payload = "forwarded-streamlocal@openssh.com", ssh.Marshal(forwardedStreamLocal{
+				SocketPath: f.Socket,
+			})
+		}
+
+		channel, reqs, err := s.secureConn.OpenChannel(channelType, payload)
+		if err != nil {
+			done <- opened{err: err}
+			return
+		}
+
+		go ssh.DiscardRequests(reqs)
 
-	cConn := &ChannelConn{Channel: channel}
+		done <- opened{channel: channel}
+	}()
+
+	var channel ssh.Channel
+	select {
+	case o := <-done:
+		if o.err != nil {
+			return nil, fmt.Errorf("could not open remote channel: %w", o.err)
+		}
+
+		channel = o.channel
+	case <-ctx.Done():
+		go func() {
+			if o := <-done; o.channel != nil {
+				o.channel.Close()
+			}
+		}()
+
+		return nil, fmt.Errorf("client did not accept connection: %w", ctx.Err())
+	}
+
+	// the connection is from remotemoe it self, to the forwarded port of this session
+	cConn := NewChannelConn(channel, s.clearConn.LocalAddr(), Addr{Host: s.FQDN(), Port: uint32(p)})
 	return cConn, nil
 
 }
 
+// Notify passes a message from the router on to the user - messages are dropped
+// if the user is not reading them anyway
+func (s *Session) Notify(msg string) {
+	notice := color.New(color.BgBlue, color.FgWhite, color.Bold)
+	notice.EnableColor()
+
+	select {
+	case s.msgs <- fmt.Sprintf("%s: %s", notice.Sprint("notice"), msg):
+	default:
+	}
+}
+
 // Replaced is called when another ssh session is replacing this current one
 func (s *Session) Replaced() {
 	warning := color.New(color.BgYellow, color.FgBlack, color.Bold)
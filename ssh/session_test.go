@@ -0,0 +1,402 @@
+package ssh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fasmide/remotemoe/routertwo"
+	"github.com/fasmide/remotemoe/services"
+	"golang.org/x/crypto/ssh"
+)
+
+func newSigner(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %s", err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("unable to create signer: %s", err)
+	}
+
+	return signer
+}
+
+// newServer serves ssh with server on localhost, with a router of its own
+func newServer(t *testing.T, server *Server) (*Server, net.Listener) {
+	router, err := routertwo.NewRouter(routertwo.NewDirStore(t.TempDir(), ""))
+	if err != nil {
+		t.Fatalf("unable to create new router: %s", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			return &ssh.Permissions{Extensions: map[string]string{"pubkey-ish": fingerprintIsh(key)}}, nil
+		},
+	}
+	config.AddHostKey(newSigner(t))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %s", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	server.Config = config
+	server.Router = router
+	go server.Serve(l)
+
+	return server, l
+}
+
+// newClient connects to addr, and echoes every connection forwarded to it
+func newClient(t *testing.T, addr string) (ssh.Conn, string) {
+	signer := newSigner(t)
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("unable to connect: %s", err)
+	}
+
+	conn, chans, reqs, err := ssh.NewClientConn(c, addr, &ssh.ClientConfig{
+		User:            "echo",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatalf("unable to handshake: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go ssh.DiscardRequests(reqs)
+
+	go func() {
+		for nc := range chans {
+			channel, requests, err := nc.Accept()
+			if err != nil {
+				continue
+			}
+
+			go ssh.DiscardRequests(requests)
+
+			go func() {
+				io.Copy(channel, channel)
+				channel.Close()
+			}()
+		}
+	}()
+
+	return conn, fmt.Sprintf("%s.%s", fingerprintIsh(signer.PublicKey()), services.Hostname)
+}
+
+// stalledClient forwards port 80, but never answers when connections are forwarded to it
+func stalledClient(t *testing.T, addr string) string {
+	signer := newSigner(t)
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("unable to connect: %s", err)
+	}
+
+	conn, _, reqs, err := ssh.NewClientConn(c, addr, &ssh.ClientConfig{
+		User:            "stalled",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatalf("unable to handshake: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go ssh.DiscardRequests(reqs)
+
+	// channels opened by the server are never accepted, nor rejected
+	ok, _, err := conn.SendRequest("tcpip-forward", true, ssh.Marshal(tcpIPForward{Rport: 80}))
+	if err != nil || !ok {
+		t.Fatalf("unable to forward port: %t %v", ok, err)
+	}
+
+	return fmt.Sprintf("%s.%s", fingerprintIsh(signer.PublicKey()), services.Hostname)
+}
+
+func TestDialContextCancel(t *testing.T) {
+	server, l := newServer(t, &Server{})
+	fqdn := stalledClient(t, l.Addr().String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+
+	_, err := server.Router.DialContext(ctx, "tcp", net.JoinHostPort(fqdn, "80"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected dial to be given up on, got: %v", err)
+	}
+
+	if time.Since(started) > time.Second {
+		t.Fatalf("dial took %s, long after the context was done", time.Since(started))
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err = server.Router.DialContext(ctx, "tcp", net.JoinHostPort(fqdn, "80"))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected dial to be cancelled, got: %v", err)
+	}
+}
+
+func TestDialTimeout(t *testing.T) {
+	server, l := newServer(t, &Server{DialTimeout: 100 * time.Millisecond})
+	fqdn := stalledClient(t, l.Addr().String())
+
+	started := time.Now()
+
+	_, err := server.Router.DialContext(context.Background(), "tcp", net.JoinHostPort(fqdn, "80"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected dial to time out, got: %v", err)
+	}
+
+	if time.Since(started) > time.Second {
+		t.Fatalf("dial took %s, long after the dial timeout", time.Since(started))
+	}
+}
+
+func TestCancelForward(t *testing.T) {
+	server, l := newServer(t, &Server{})
+	conn, fqdn := newClient(t, l.Addr().String())
+
+	for _, p := range []uint32{80, 22} {
+		ok, _, err := conn.SendRequest("tcpip-forward", true, ssh.Marshal(tcpIPForward{Rport: p}))
+		if err != nil || !ok {
+			t.Fatalf("unable to forward port %d: %t %v", p, ok, err)
+		}
+	}
+
+	c, err := server.Router.DialContext(context.Background(), "tcp", net.JoinHostPort(fqdn, "80"))
+	if err != nil {
+		t.Fatalf("unable to dial forwarded port: %s", err)
+	}
+
+	c.Close()
+
+	ok, _, err := conn.SendRequest("cancel-tcpip-forward", true, ssh.Marshal(tcpIPForward{Rport: 80}))
+	if err != nil || !ok {
+		t.Fatalf("unable to cancel forward: %t %v", ok, err)
+	}
+
+	_, err = server.Router.DialContext(context.Background(), "tcp", net.JoinHostPort(fqdn, "80"))
+	if err == nil {
+		t.Fatalf("expected cancelled port to be unavailable")
+	}
+
+	// ports not forwarded cannot be cancelled
+	ok, _, _ = conn.SendRequest("cancel-tcpip-forward", true, ssh.Marshal(tcpIPForward{Rport: 80}))
+	if ok {
+		t.Fatalf("expected cancelling port 80 again to fail")
+	}
+
+	// the session is still around with its other port
+	host, _ := server.Router.Find(fqdn)
+	if host.(*routertwo.Host).Routable == nil {
+		t.Fatalf("expected session to be online with a forward left")
+	}
+
+	// but leaves the router along with its last forward
+	conn.SendRequest("cancel-tcpip-forward", true, ssh.Marshal(tcpIPForward{Rport: 22}))
+
+	host, _ = server.Router.Find(fqdn)
+	if host.(*routertwo.Host).Routable != nil {
+		t.Fatalf("expected session to be offline without any forwards")
+	}
+
+	// and joins again when forwarding again
+	conn.SendRequest("tcpip-forward", true, ssh.Marshal(tcpIPForward{Rport: 80}))
+
+	c, err = server.Router.DialContext(context.Background(), "tcp", net.JoinHostPort(fqdn, "80"))
+	if err != nil {
+		t.Fatalf("unable to dial forwarded port: %s", err)
+	}
+
+	c.Close()
+}
+
+func TestNamedForwards(t *testing.T) {
+	server, l := newServer(t, &Server{})
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to connect: %s", err)
+	}
+
+	signer := newSigner(t)
+	conn, chans, reqs, err := ssh.NewClientConn(c, l.Addr().String(), &ssh.ClientConfig{
+		User:            "named",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatalf("unable to handshake: %s", err)
+	}
+	defer conn.Close()
+
+	go ssh.DiscardRequests(reqs)
+
+	// connections are answered with the address of the forward they were made to
+	go func() {
+		for nc := range chans {
+			var forwarded directTCPIP
+			ssh.Unmarshal(nc.ExtraData(), &forwarded)
+
+			channel, requests, err := nc.Accept()
+			if err != nil {
+				continue
+			}
+
+			go ssh.DiscardRequests(requests)
+
+			channel.Write([]byte(forwarded.Addr))
+			channel.Close()
+		}
+	}()
+
+	for _, addr := range []string{"app.example.com", "api.example.com", "*.example.com", "localhost"} {
+		ok, _, err := conn.SendRequest("tcpip-forward", true, ssh.Marshal(tcpIPForward{Addr: addr, Rport: 80}))
+		if err != nil || !ok {
+			t.Fatalf("unable to forward %s: %t %v", addr, ok, err)
+		}
+	}
+
+	fqdn := fmt.Sprintf("%s.%s", fingerprintIsh(signer.PublicKey()), services.Hostname)
+	host, _ := server.Router.Find(fqdn)
+
+	for _, name := range []string{"app.example.com", "api.example.com", "*.example.com"} {
+		err = server.Router.AddName(routertwo.NewName(name, host))
+		if err != nil {
+			t.Fatalf("unable to add %s: %s", name, err)
+		}
+	}
+
+	expect := map[string]string{
+		"app.example.com":   "app.example.com",
+		"api.example.com":   "api.example.com",
+		"other.example.com": "*.example.com",
+		fqdn:                "localhost",
+	}
+
+	for name, addr := range expect {
+		c, err := server.Router.DialContext(context.Background(), "tcp", net.JoinHostPort(name, "80"))
+		if err != nil {
+			t.Fatalf("unable to dial %s: %s", name, err)
+		}
+
+		answer, _ := io.ReadAll(c)
+		c.Close()
+
+		if string(answer) != addr {
+			t.Fatalf("expected %s to reach the forward of %s, reached %q", name, addr, answer)
+		}
+	}
+
+	// without a forward for any hostname, only the named ones are reachable
+	ok, _, err := conn.SendRequest("cancel-tcpip-forward", true, ssh.Marshal(tcpIPForward{Addr: "localhost", Rport: 80}))
+	if err != nil || !ok {
+		t.Fatalf("unable to cancel forward: %t %v", ok, err)
+	}
+
+	_, err = server.Router.DialContext(context.Background(), "tcp", net.JoinHostPort(fqdn, "80"))
+	if err == nil {
+		t.Fatalf("expected %s to be unavailable without a forward for it", fqdn)
+	}
+}
+
+func TestStreamLocalForward(t *testing.T) {
+	server, l := newServer(t, &Server{})
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to connect: %s", err)
+	}
+
+	signer := newSigner(t)
+	conn, chans, reqs, err := ssh.NewClientConn(c, l.Addr().String(), &ssh.ClientConfig{
+		User:            "streamlocal",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatalf("unable to handshake: %s", err)
+	}
+	defer conn.Close()
+
+	go ssh.DiscardRequests(reqs)
+
+	// connections are answered with the socket they were made to
+	go func() {
+		for nc := range chans {
+			if nc.ChannelType() != "forwarded-streamlocal@openssh.com" {
+				nc.Reject(ssh.UnknownChannelType, "expected streamlocal")
+				continue
+			}
+
+			var forwarded forwardedStreamLocal
+			ssh.Unmarshal(nc.ExtraData(), &forwarded)
+
+			channel, requests, err := nc.Accept()
+			if err != nil {
+				continue
+			}
+
+			go ssh.DiscardRequests(requests)
+
+			channel.Write([]byte(forwarded.SocketPath))
+			channel.Close()
+		}
+	}()
+
+	ok, _, _ := conn.SendRequest("streamlocal-forward@openssh.com", true, ssh.Marshal(streamLocalForward{SocketPath: "/run/app/smtp"}))
+	if ok {
+		t.Fatalf("expected socket not naming a service to be rejected")
+	}
+
+	for _, socket := range []string{"/run/app/http", "/run/app/8443.sock"} {
+		ok, _, err := conn.SendRequest("streamlocal-forward@openssh.com", true, ssh.Marshal(streamLocalForward{SocketPath: socket}))
+		if err != nil || !ok {
+			t.Fatalf("unable to forward %s: %t %v", socket, ok, err)
+		}
+	}
+
+	fqdn := fmt.Sprintf("%s.%s", fingerprintIsh(signer.PublicKey()), services.Hostname)
+
+	for port, socket := range map[string]string{"80": "/run/app/http", "8443": "/run/app/8443.sock"} {
+		c, err := server.Router.DialContext(context.Background(), "tcp", net.JoinHostPort(fqdn, port))
+		if err != nil {
+			t.Fatalf("unable to dial port %s: %s", port, err)
+		}
+
+		answer, _ := io.ReadAll(c)
+		c.Close()
+
+		if string(answer) != socket {
+			t.Fatalf("expected port %s to reach %s, reached %q", port, socket, answer)
+		}
+	}
+
+	ok, _, err = conn.SendRequest("cancel-streamlocal-forward@openssh.com", true, ssh.Marshal(streamLocalForward{SocketPath: "/run/app/http"}))
+	if err != nil || !ok {
+		t.Fatalf("unable to cancel forward: %t %v", ok, err)
+	}
+
+	_, err = server.Router.DialContext(context.Background(), "tcp", net.JoinHostPort(fqdn, "80"))
+	if err == nil {
+		t.Fatalf("expected cancelled socket to be unavailable")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/fasmide/remotemoe/routertwo"
+)
+
+// stateFile returns the path of name inside systemd's state directory
+// or the current working directory if there is none
+func stateFile(name string) string {
+	if os.Getenv("STATE_DIRECTORY") != "" {
+		return path.Join(os.Getenv("STATE_DIRECTORY"), name)
+	}
+
+	return name
+}
+
+// openStore opens the router store of the given kind, "dir" being the default
+func openStore(kind string) (routertwo.Store, error) {
+	switch kind {
+	case "", "dir":
+		return openDirStore(stateFile("routerdata"))
+	case "bolt":
+		return routertwo.NewBoltStore(stateFile("routerdata.db"))
+	}
+
+	return nil, fmt.Errorf("unknown store %q, use dir or bolt", kind)
+}
+
+func openDirStore(dir string) (*routertwo.DirStore, error) {
+	err := os.Mkdir(dir, 0700)
+
+	// we are not going to be stopping on ErrExists errors
+	if errors.Is(err, os.ErrExist) {
+		err = nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to make directory for router data: %w", err)
+	}
+
+	return routertwo.NewDirStore(dir, stateFile("routerquarantine")), nil
+}